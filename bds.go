@@ -0,0 +1,743 @@
+package xmss
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// BDS tree traversal (Buchmann, Dahmen, Schneider: "Merkle Tree Traversal
+// Revisited", 2008), following xmss_core_fast.c of the reference
+// implementation. Instead of recomputing the tree for every signature, the
+// state holds the current authentication path and computes the nodes of the
+// upcoming paths a few leaves at a time, so that a signature costs at most
+// (h - k) / 2 + 1 leaf computations on top of the WOTS signature. A larger k
+// keeps 2^k - k - 1 nodes near the root in memory in exchange for fewer
+// updates.
+
+// treehashInst is an instance of TreeHash that computes the next right node
+// of the authentication path at height h
+type treehashInst struct {
+	h          uint32
+	nextIdx    uint32
+	stackUsage uint32
+	completed  bool
+	node       []byte
+}
+
+// bdsState is the traversal state of a single tree. The TreeHash instances
+// share one stack.
+type bdsState struct {
+	k           uint32
+	stack       []byte
+	stackOffset uint32
+	stackLevels []uint32
+	auth        []byte
+	keep        []byte
+	treehash    []treehashInst
+	retain      []byte
+}
+
+// validBDSK reports whether k is a valid BDS parameter for params. The
+// traversal needs h - k to be even, where h is the height of a single tree.
+func validBDSK(params *Params, k int) bool {
+	return k >= 0 && k <= int(params.treeHeight) && (int(params.treeHeight)-k)%2 == 0
+}
+
+func newBDSState(params *Params, k uint32) *bdsState {
+	n := uint32(params.n)
+	h := params.treeHeight
+	s := &bdsState{
+		k:           k,
+		stack:       make([]byte, (h+1)*n),
+		stackLevels: make([]uint32, h+1),
+		auth:        make([]byte, h*n),
+		keep:        make([]byte, (h>>1)*n),
+		treehash:    make([]treehashInst, h-k),
+		retain:      make([]byte, ((1<<k)-k-1)*n),
+	}
+	for i := range s.treehash {
+		s.treehash[i].node = make([]byte, n)
+	}
+	return s
+}
+
+// retainIndex returns the position in retain of the right node at the given
+// height (h - k <= height < h) and odd index >= 3
+func retainIndex(h, height, index uint32) uint32 {
+	return (1 << (h - 1 - height)) - (h - height) + ((index - 3) >> 1)
+}
+
+// nodeRef identifies a node by its height and its index within that height
+type nodeRef struct {
+	height, index uint32
+	ok            bool
+}
+
+// keepNodes returns for every slot of keep the node that the next round
+// reading the slot expects to find there, if leaf is the next leaf to sign.
+// Slots that are written before they are read again are left out.
+func keepNodes(h, leaf uint32) []nodeRef {
+	refs := make([]nodeRef, h>>1)
+	for slot := range refs {
+		for r := leaf; r < (1<<h)-1; r++ {
+			tau := uint32(bits.TrailingZeros32(^r))
+			if tau > 0 && int((tau-1)>>1) == slot {
+				refs[slot] = nodeRef{height: tau - 1, index: r >> (tau - 1), ok: true}
+				break
+			}
+			if (r>>(tau+1))&1 == 0 && tau < h-1 && int(tau>>1) == slot {
+				break
+			}
+		}
+	}
+	return refs
+}
+
+// build sets up the state for signing leaf of the tree at subtreeA in a
+// single pass over the tree and writes the root of the tree to root. For leaf
+// 0 this is treehash_init of the reference implementation. For other leaves it
+// is the state the traversal reaches there, except that every TreeHash
+// instance has already completed, which the traversal allows. The tree is
+// computed by workers goroutines, see treeNodesParallel. If it is cancelled,
+// the state is unusable.
+func (s *bdsState) build(hs *hasher, root []byte, leaf uint32, subtreeA address, workers int) error {
+	return treeNodesParallel(hs, root, subtreeA, workers, s.startBuild(hs.params, leaf))
+}
+
+// startBuild resets the state for build and returns the visit function of
+// the pass over the tree. The nodes the pass has collected are in auth, keep,
+// retain and the nodes of the TreeHash instances.
+func (s *bdsState) startBuild(params *Params, leaf uint32) func(height, index uint32, node []byte) {
+	n := uint32(params.n)
+	h := params.treeHeight
+	keep := keepNodes(h, leaf)
+
+	s.stackOffset = 0
+	for i := range s.treehash {
+		s.treehash[i] = treehashInst{h: uint32(i), completed: true, node: s.treehash[i].node}
+	}
+
+	return func(height, index uint32, node []byte) {
+		if height >= h {
+			return
+		}
+		if ((leaf >> height) ^ 1) == index {
+			copy(s.auth[height*n:], node)
+		}
+		if height < h-s.k {
+			// The instance at this height was last started when the leaves
+			// below the previous right node at this height were used up
+			start := leaf &^ (1<<(height+1) - 1)
+			if (start>>height)+3 == index {
+				copy(s.treehash[height].node, node)
+			}
+		} else if index&1 == 1 && index >= 3 {
+			copy(s.retain[retainIndex(h, height, index)*n:], node)
+		}
+		for slot, ref := range keep {
+			if ref.ok && ref.height == height && ref.index == index {
+				copy(s.keep[uint32(slot)*n:], node)
+			}
+		}
+	}
+}
+
+// round updates the authentication path from leaf to leaf + 1 after leaf
+// was used and restarts the TreeHash instances that completed, like bds_round
+// of the reference implementation. leaf must not be the last leaf.
+func (s *bdsState) round(hs *hasher, leaf uint32, subtreeA address) {
+	params := hs.params
+	n := uint32(params.n)
+	h := params.treeHeight
+	buf := make([]byte, 2*n)
+
+	var otsA, ltreeA, nodeA address
+	otsA.copySubtreeAddr(subtreeA)
+	ltreeA.copySubtreeAddr(subtreeA)
+	nodeA.copySubtreeAddr(subtreeA)
+	otsA.setType(xmssAddrTypeOTS)
+	ltreeA.setType(xmssAddrTypeLTREE)
+	nodeA.setType(xmssAddrTypeHASHTREE)
+
+	// tau is the height of the first left node on the path of leaf
+	tau := uint32(bits.TrailingZeros32(^leaf))
+
+	if tau > 0 {
+		copy(buf[:n], s.auth[(tau-1)*n:tau*n])
+		// Read keep before it is refreshed below
+		copy(buf[n:], s.keep[((tau-1)>>1)*n:])
+	}
+	if (leaf>>(tau+1))&1 == 0 && tau < h-1 {
+		copy(s.keep[(tau>>1)*n:], s.auth[tau*n:(tau+1)*n])
+	}
+	if tau == 0 {
+		ltreeA.setLTreeAddr(leaf)
+		otsA.setOTSAddr(leaf)
+		generateLeafWOTS(hs, s.auth[:n], &ltreeA, &otsA)
+		return
+	}
+
+	nodeA.setTreeHeight(tau - 1)
+	nodeA.setTreeIndex(leaf >> tau)
+	hs.hashH(s.auth[tau*n:(tau+1)*n], buf, &nodeA)
+	for i := uint32(0); i < tau; i++ {
+		if i < h-s.k {
+			copy(s.auth[i*n:], s.treehash[i].node)
+		} else {
+			r := retainIndex(h, i, (leaf>>i)+2) * n
+			copy(s.auth[i*n:], s.retain[r:r+n])
+		}
+	}
+
+	for i := uint32(0); i < tau && i < h-s.k; i++ {
+		start := leaf + 1 + 3<<i
+		if start < 1<<h {
+			s.treehash[i] = treehashInst{h: i, nextIdx: start, node: s.treehash[i].node}
+		}
+	}
+}
+
+// minHeightOnStack returns the lowest height of the nodes inst keeps on the
+// shared stack
+func (s *bdsState) minHeightOnStack(params *Params, inst *treehashInst) uint32 {
+	r := params.treeHeight
+	for i := uint32(0); i < inst.stackUsage; i++ {
+		if level := s.stackLevels[s.stackOffset-i-1]; level < r {
+			r = level
+		}
+	}
+	return r
+}
+
+// treehashUpdate computes the next leaf of inst and merges it with the nodes
+// of inst on the stack
+func (s *bdsState) treehashUpdate(hs *hasher, inst *treehashInst, subtreeA address) {
+	params := hs.params
+	n := uint32(params.n)
+	buf := make([]byte, 2*n)
+
+	var otsA, ltreeA, nodeA address
+	otsA.copySubtreeAddr(subtreeA)
+	ltreeA.copySubtreeAddr(subtreeA)
+	nodeA.copySubtreeAddr(subtreeA)
+	otsA.setType(xmssAddrTypeOTS)
+	ltreeA.setType(xmssAddrTypeLTREE)
+	nodeA.setType(xmssAddrTypeHASHTREE)
+
+	ltreeA.setLTreeAddr(inst.nextIdx)
+	otsA.setOTSAddr(inst.nextIdx)
+	generateLeafWOTS(hs, buf[:n], &ltreeA, &otsA)
+
+	height := uint32(0)
+	for inst.stackUsage > 0 && s.stackLevels[s.stackOffset-1] == height {
+		copy(buf[n:], buf[:n])
+		copy(buf[:n], s.stack[(s.stackOffset-1)*n:])
+		nodeA.setTreeHeight(height)
+		nodeA.setTreeIndex(inst.nextIdx >> (height + 1))
+		hs.hashH(buf[:n], buf, &nodeA)
+		height++
+		inst.stackUsage--
+		s.stackOffset--
+	}
+
+	if height == inst.h {
+		copy(inst.node, buf[:n])
+		inst.completed = true
+		return
+	}
+	copy(s.stack[s.stackOffset*n:], buf[:n])
+	inst.stackUsage++
+	s.stackLevels[s.stackOffset] = height
+	s.stackOffset++
+	inst.nextIdx++
+}
+
+// update spends up to updates leaf computations on the TreeHash instances,
+// always advancing the one with the lowest node, and returns the updates it
+// did not need
+func (s *bdsState) update(hs *hasher, updates uint32, subtreeA address) uint32 {
+	params := hs.params
+	h := params.treeHeight
+	for j := uint32(0); j < updates; j++ {
+		lMin := h
+		level := h - s.k
+		for i := uint32(0); i < h-s.k; i++ {
+			var low uint32
+			inst := &s.treehash[i]
+			switch {
+			case inst.completed:
+				low = h
+			case inst.stackUsage == 0:
+				low = i
+			default:
+				low = s.minHeightOnStack(params, inst)
+			}
+			if low < lMin {
+				level = i
+				lMin = low
+			}
+		}
+		if level == h-s.k {
+			return updates - j
+		}
+		s.treehashUpdate(hs, &s.treehash[level], subtreeA)
+	}
+	return 0
+}
+
+// traversal is the signing state a PrivateKey keeps next to its key, like the
+// BDS states of xmssmt_core_sign in xmss_core_fast.c. Every layer has the BDS
+// state of its current tree. Below the top layer, it also has the next tree,
+// which is computed a few leaves per signature, and the WOTS signature over
+// the root of the current tree by the layer above. A signature therefore
+// never computes a whole tree, not even when it moves to the next tree.
+type traversal struct {
+	k     uint32
+	ready bool
+	// next is the index the state is prepared for
+	next   uint64
+	layers []*bdsState
+	// upcoming[i] is the next tree on layer i, and sigs holds the signature
+	// over the root of the current tree of layer i at i * wotsSignLen
+	upcoming []*upcomingTree
+	sigs     []byte
+}
+
+// upcomingTree is the next tree of a layer, computed leaf by leaf with
+// TreeHash while the BDS state for its first leaf is collected
+type upcomingTree struct {
+	bds   *bdsState
+	st    *treeHashState
+	visit func(height, index uint32, node []byte)
+}
+
+func newTraversal(params *Params, k int) (*traversal, error) {
+	if !validBDSK(params, k) {
+		return nil, fmt.Errorf("xmss: invalid BDS parameter k = %d for tree height %d", k, params.treeHeight)
+	}
+	t := &traversal{
+		k:        uint32(k),
+		layers:   make([]*bdsState, params.d),
+		upcoming: make([]*upcomingTree, params.d-1),
+		sigs:     make([]byte, uint32(params.d-1)*params.wotsSignLen),
+	}
+	for i := range t.layers {
+		t.layers[i] = newBDSState(params, t.k)
+	}
+	for i := range t.upcoming {
+		t.upcoming[i] = &upcomingTree{bds: newBDSState(params, t.k)}
+		t.upcoming[i].reset(params)
+	}
+	return t, nil
+}
+
+// reset starts the computation of the tree over
+func (u *upcomingTree) reset(params *Params) {
+	u.st = newTreeHashState(params, 0, params.treeHeight)
+	u.visit = u.bds.startBuild(params, 0)
+}
+
+// remaining returns the number of leaves that are not computed yet
+func (u *upcomingTree) remaining(params *Params) uint32 {
+	return 1<<params.treeHeight - u.st.next
+}
+
+// step computes the next leaves of the tree at subtreeA. hs must have no
+// progress, so that it cannot fail.
+func (u *upcomingTree) step(hs *hasher, subtreeA address, leaves uint32) {
+	u.st.run(hs, subtreeA, u.st.next+leaves, u.visit, nil)
+}
+
+// build computes the whole tree at subtreeA with workers goroutines, see
+// treeNodesParallel. The state is complete as if it had been computed leaf by
+// leaf.
+func (u *upcomingTree) build(hs *hasher, subtreeA address, workers int) error {
+	params := hs.params
+	u.reset(params)
+	root := make([]byte, params.n)
+	if err := u.bds.build(hs, root, 0, subtreeA, workers); err != nil {
+		return err
+	}
+	u.st.next = 1 << params.treeHeight
+	u.st.offset = 1
+	u.st.heights[0] = params.treeHeight
+	copy(u.st.stack, root)
+	return nil
+}
+
+// position returns the tree on layer that index idx signs with and the leaf
+// within that tree
+func position(params *Params, layer uint32, idx uint64) (tree uint64, leaf uint32) {
+	h := params.treeHeight
+	tree = idx >> (h * layer)
+	return tree >> h, uint32(tree) & (1<<h - 1)
+}
+
+// treeAddress returns the address of the tree on layer that idx signs with
+func treeAddress(params *Params, layer uint32, idx uint64) address {
+	var a address
+	a.setLayerAddr(layer)
+	tree, _ := position(params, layer, idx)
+	a.setTreeAddr(tree)
+	return a
+}
+
+// otsAddress returns the address of the one-time key on layer that idx
+// signs with
+func otsAddress(params *Params, layer uint32, idx uint64) address {
+	a := treeAddress(params, layer, idx)
+	_, leaf := position(params, layer, idx)
+	a.setType(xmssAddrTypeOTS)
+	a.setOTSAddr(leaf)
+	return a
+}
+
+// signsLeft returns the number of signatures from idx on, idx included, that
+// the current tree on layer is used for
+func signsLeft(params *Params, layer uint32, idx uint64) uint64 {
+	span := uint64(1) << (params.treeHeight * (layer + 1))
+	return span - idx&(span-1)
+}
+
+// hasNextTree reports whether the tree on layer that idx signs with is
+// followed by another tree on that layer
+func hasNextTree(params *Params, layer uint32, idx uint64) bool {
+	tree, _ := position(params, layer, idx)
+	return tree+1 < uint64(1)<<(params.treeHeight*(uint32(params.d)-1-layer))
+}
+
+// pace returns the number of leaves the next tree on layer needs at idx to
+// be complete when the current tree is used up. Above the bottom layer, the
+// signature that uses up the tree swaps instead of computing leaves.
+func (t *traversal) pace(params *Params, layer uint32, idx uint64) uint64 {
+	remaining := uint64(t.upcoming[layer].remaining(params))
+	left := signsLeft(params, layer, idx)
+	if layer > 0 {
+		left--
+	}
+	if left == 0 {
+		return remaining
+	}
+	return (remaining + left - 1) / left
+}
+
+// maxLeaves returns the number of leaves a signature computes for the BDS
+// state of its bottom tree and the next tree of the bottom layer at most
+func (t *traversal) maxLeaves(params *Params) uint64 {
+	return uint64((params.treeHeight-t.k)>>1) + 2
+}
+
+// prepare makes the state ready to sign idx. A state that is a few indices
+// behind, e.g. because reserved indices were skipped, is advanced to idx.
+// Otherwise the current tree of every layer is computed from the seeds,
+// using all CPUs, and signed by the layer above.
+func (t *traversal) prepare(hs *hasher, pubRoot []byte, idx uint64) error {
+	params := hs.params
+	if t.ready && t.next <= idx && idx-t.next <= (uint64(params.d)<<params.treeHeight)/t.maxLeaves(params) {
+		for t.next < idx {
+			if err := hs.prog.err(); err != nil {
+				return err
+			}
+			t.advance(hs, t.next)
+		}
+		return nil
+	}
+	t.ready = false
+	hs.prog.expect(uint64(params.d) << params.treeHeight)
+	n := params.n
+	root := make([]byte, n)
+	for i := range t.layers {
+		layer := uint32(i)
+		if layer > 0 {
+			otsA := otsAddress(params, layer, idx)
+			signOTS(hs, t.sigs[(layer-1)*params.wotsSignLen:layer*params.wotsSignLen], root, &otsA)
+		}
+		_, leaf := position(params, layer, idx)
+		if err := t.layers[i].build(hs, root, leaf, treeAddress(params, layer, idx), 0); err != nil {
+			return err
+		}
+	}
+	if !bytes.Equal(root, pubRoot) {
+		return ErrRootMismatch
+	}
+	for i, u := range t.upcoming {
+		layer := uint32(i)
+		u.reset(params)
+		if !hasNextTree(params, layer, idx) || t.pace(params, layer, idx) <= t.maxLeaves(params) {
+			continue
+		}
+		// The current tree is nearly used up, computing the next one leaf by
+		// leaf would make the next signatures slow
+		hs.prog.expect(1 << params.treeHeight)
+		if err := u.build(hs, treeAddress(params, layer, idx+signsLeft(params, layer, idx)), 0); err != nil {
+			return err
+		}
+	}
+	t.next = idx
+	t.ready = true
+	return nil
+}
+
+// authPaths writes the authentication path and the layers above for idx to
+// sm, and advances the state to idx + 1
+func (t *traversal) authPaths(hs *hasher, sm, pubRoot []byte, idx uint64) error {
+	params := hs.params
+	if err := t.prepare(hs, pubRoot, idx); err != nil {
+		return err
+	}
+
+	// The authentication paths were computed by the previous rounds
+	for i, s := range t.layers {
+		if i > 0 {
+			sm = sm[copy(sm, t.sigs[uint32(i-1)*params.wotsSignLen:uint32(i)*params.wotsSignLen]):]
+		}
+		sm = sm[copy(sm, s.auth):]
+	}
+	t.advance(hs, idx)
+	return nil
+}
+
+// advance moves the state from idx to idx + 1 like xmssmt_core_sign of
+// xmss_core_fast.c. The next tree of the bottom layer gets a leaf. A layer
+// whose leaf changes gets a BDS round, and the TreeHash updates that the
+// layers below did not need go to its TreeHash instances, then to its next
+// tree. A layer whose tree is used up swaps in its next tree. The work is
+// not reported as progress.
+func (t *traversal) advance(hs *hasher, idx uint64) {
+	params := hs.params
+	h := params.treeHeight
+	t.next = idx + 1
+	if t.next >= params.MaxSignatures() {
+		return
+	}
+	prog := hs.prog
+	hs.prog = nil
+	defer func() { hs.prog = prog }()
+
+	if params.d > 1 && hasNextTree(params, 0, idx) {
+		t.upcoming[0].step(hs, treeAddress(params, 0, idx+signsLeft(params, 0, idx)), uint32(t.pace(params, 0, idx)))
+	}
+	updates := (h - t.k) >> 1
+	for i := range t.layers {
+		layer := uint32(i)
+		if signsLeft(params, layer, idx) == 1 {
+			t.swap(hs, layer, idx+1)
+			// Signing the new root counts as an update
+			if updates > 0 {
+				updates--
+			}
+			continue
+		}
+		subtreeA := treeAddress(params, layer, idx)
+		if (idx+1)&(uint64(1)<<(h*layer)-1) == 0 {
+			// The layers below have swapped, so the leaf of this layer changes
+			_, leaf := position(params, layer, idx)
+			t.layers[i].round(hs, leaf, subtreeA)
+		}
+		updates = t.layers[i].update(hs, updates, subtreeA)
+		if layer == 0 || layer == uint32(params.d)-1 || !hasNextTree(params, layer, idx) {
+			continue
+		}
+		u := t.upcoming[i]
+		leaves := t.pace(params, layer, idx)
+		if leaves == 0 && updates > 0 && u.remaining(params) > 0 {
+			leaves = 1
+			updates--
+		}
+		u.step(hs, treeAddress(params, layer, idx+signsLeft(params, layer, idx)), uint32(leaves))
+	}
+}
+
+// swap replaces the used up tree on layer with its next tree, which next is
+// the first index of, and signs the root of the next tree by the layer above
+func (t *traversal) swap(hs *hasher, layer uint32, next uint64) {
+	params := hs.params
+	u := t.upcoming[layer]
+	// Only the next tree of a state rebuilt shortly before is incomplete
+	u.step(hs, treeAddress(params, layer, next), u.remaining(params))
+	t.layers[layer], u.bds = u.bds, t.layers[layer]
+	otsA := otsAddress(params, layer+1, next)
+	signOTS(hs, t.sigs[layer*params.wotsSignLen:(layer+1)*params.wotsSignLen], u.st.stack[:params.n], &otsA)
+	u.reset(params)
+}
+
+// traversalMagic starts every stored traversal state
+var traversalMagic = []byte("XMSSTRAV")
+
+// stateDecoder reads the fields written by the marshal functions of the
+// traversal state. Once the input is too short or a field is out of range,
+// ok is false and every further read returns zeros.
+type stateDecoder struct {
+	b  []byte
+	ok bool
+}
+
+func (d *stateDecoder) uint32(max uint32) uint32 {
+	if !d.ok || len(d.b) < 4 {
+		d.ok = false
+		return 0
+	}
+	v := binary.BigEndian.Uint32(d.b)
+	d.b = d.b[4:]
+	if v > max {
+		d.ok = false
+		return 0
+	}
+	return v
+}
+
+func (d *stateDecoder) bytes(out []byte) {
+	if !d.ok || len(d.b) < len(out) {
+		d.ok = false
+		return
+	}
+	d.b = d.b[copy(out, d.b):]
+}
+
+func appendUint32(b []byte, vs ...uint32) []byte {
+	var word [4]byte
+	for _, v := range vs {
+		binary.BigEndian.PutUint32(word[:], v)
+		b = append(b, word[:]...)
+	}
+	return b
+}
+
+// marshal appends the state as [next || offset || heights || stack] to b
+func (st *treeHashState) marshal(b []byte, n uint32) []byte {
+	b = appendUint32(b, st.next, st.offset)
+	b = appendUint32(b, st.heights[:st.offset]...)
+	return append(b, st.stack[:st.offset*n]...)
+}
+
+// unmarshal reads a state written by marshal for a tree of the height st was
+// created for
+func (st *treeHashState) unmarshal(d *stateDecoder, n uint32) {
+	height := uint32(len(st.heights)) - 1
+	st.next = d.uint32(1 << height)
+	st.offset = d.uint32(height + 1)
+	for i := range st.heights[:st.offset] {
+		st.heights[i] = d.uint32(height)
+	}
+	d.bytes(st.stack[:st.offset*n])
+}
+
+// marshal appends the state as [stack offset || stack levels || stack ||
+// auth || keep || retain || TreeHash instances] to b, where every instance is
+// [next leaf || stack usage || completed || node]
+func (s *bdsState) marshal(b []byte, n uint32) []byte {
+	b = appendUint32(b, s.stackOffset)
+	b = appendUint32(b, s.stackLevels[:s.stackOffset]...)
+	b = append(b, s.stack[:s.stackOffset*n]...)
+	b = append(b, s.auth...)
+	b = append(b, s.keep...)
+	b = append(b, s.retain...)
+	for _, inst := range s.treehash {
+		completed := uint32(0)
+		if inst.completed {
+			completed = 1
+		}
+		b = appendUint32(b, inst.nextIdx, inst.stackUsage, completed)
+		b = append(b, inst.node...)
+	}
+	return b
+}
+
+// unmarshal reads a state written by marshal for the parameters s was
+// created for
+func (s *bdsState) unmarshal(d *stateDecoder, n uint32) {
+	h := uint32(len(s.auth)) / n
+	s.stackOffset = d.uint32(uint32(len(s.stackLevels)))
+	for i := range s.stackLevels[:s.stackOffset] {
+		s.stackLevels[i] = d.uint32(h)
+	}
+	d.bytes(s.stack[:s.stackOffset*n])
+	d.bytes(s.auth)
+	d.bytes(s.keep)
+	d.bytes(s.retain)
+	for i := range s.treehash {
+		inst := &s.treehash[i]
+		inst.h = uint32(i)
+		inst.nextIdx = d.uint32(1<<h - 1)
+		inst.stackUsage = d.uint32(s.stackOffset)
+		inst.completed = d.uint32(1) == 1
+		d.bytes(inst.node)
+	}
+}
+
+// marshal encodes the state for the key with the public key pub as
+// [magic || name length || name || k || pub || next index || current trees ||
+// signatures || next trees || SHA-256 of the preceding bytes], where every
+// next tree is its TreeHash state followed by its BDS state
+func (t *traversal) marshal(params *Params, pub []byte) []byte {
+	n := uint32(params.n)
+	b := append([]byte(nil), traversalMagic...)
+	b = append(b, byte(len(params.name)))
+	b = append(b, params.name...)
+	b = append(b, byte(t.k))
+	b = append(b, pub...)
+	var next [8]byte
+	binary.BigEndian.PutUint64(next[:], t.next)
+	b = append(b, next[:]...)
+	for _, s := range t.layers {
+		b = s.marshal(b, n)
+	}
+	b = append(b, t.sigs...)
+	for _, u := range t.upcoming {
+		b = u.st.marshal(b, n)
+		b = u.bds.marshal(b, n)
+	}
+	digest := sha256.Sum256(b)
+	return append(b, digest[:]...)
+}
+
+// parseTraversal decodes a state written by marshal for the key with the
+// public key pub. It returns nil if b is damaged or belongs to another key or
+// parameter set, the state then has to be rebuilt.
+func parseTraversal(params *Params, pub, b []byte) *traversal {
+	if len(b) < sha256.Size {
+		return nil
+	}
+	digest := sha256.Sum256(b[:len(b)-sha256.Size])
+	if !bytes.Equal(digest[:], b[len(b)-sha256.Size:]) {
+		return nil
+	}
+	b = b[:len(b)-sha256.Size]
+
+	head := append(append(append([]byte(nil), traversalMagic...), byte(len(params.name))), params.name...)
+	if !bytes.HasPrefix(b, head) || len(b) < len(head)+1+len(pub)+8 {
+		return nil
+	}
+	b = b[len(head):]
+	t, err := newTraversal(params, int(b[0]))
+	if err != nil || !bytes.Equal(b[1:1+len(pub)], pub) {
+		return nil
+	}
+	b = b[1+len(pub):]
+	t.next = binary.BigEndian.Uint64(b)
+	if t.next > params.MaxSignatures() {
+		return nil
+	}
+
+	n := uint32(params.n)
+	d := &stateDecoder{b: b[8:], ok: true}
+	for _, s := range t.layers {
+		s.unmarshal(d, n)
+	}
+	d.bytes(t.sigs)
+	for _, u := range t.upcoming {
+		u.st.unmarshal(d, n)
+		// The next tree collects the BDS state for its first leaf, which
+		// leaves the instances and the stack as they are stored
+		u.visit = u.bds.startBuild(params, 0)
+		u.bds.unmarshal(d, n)
+	}
+	if !d.ok || len(d.b) != 0 {
+		return nil
+	}
+	t.ready = true
+	return t
+}
@@ -0,0 +1,123 @@
+package xmss
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+)
+
+// testKey returns a key for the SHA2 parameters with n = 32, w = 16, tree
+// height h and d layers, and the three distinct random seeds it is
+// generated from
+func testKey(t *testing.T, h, d int) (*PrivateKey, []byte) {
+	params, err := NewParams(SHA2, 32, 16, h, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := params.n
+	seeds := make([]byte, 3*n)
+	if _, err := rand.Read(seeds); err != nil {
+		t.Fatal(err)
+	}
+	prv, err := NewKeyFromSeeds(params, seeds[:n], seeds[n:2*n], seeds[2*n:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prv, seeds
+}
+
+// testBDS signs up to count messages with prv from its current index and
+// checks every signature against the one computed without traversal state.
+// Only the first signature may compute whole trees, and none if resumed is set.
+func testBDS(t *testing.T, prv *PrivateKey, count int, resumed bool) {
+	m := []byte("bds test message")
+	for i := 0; i < count && prv.Remaining() > 0; i++ {
+		idx := prv.Index()
+		legacy := make(PrivateXMSS, len(prv.prv))
+		copy(legacy, prv.prv)
+		want, err := legacy.SignMessage(prv.params, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var leaves uint64
+		got, err := prv.SignMessageContext(context.Background(), m, func(done, total uint64) { leaves = done })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("Signature at index %d differs from treehash", idx)
+		}
+		if (i > 0 || resumed) && leaves != 0 {
+			t.Fatalf("Signature at index %d rebuilt the traversal state", idx)
+		}
+	}
+}
+
+func TestBDS(t *testing.T) {
+	t.Parallel()
+	for _, h := range []int{4, 5} {
+		for k := h % 2; k <= h; k += 2 {
+			prv, _ := testKey(t, h, 1)
+			if err := prv.SetBDS(k); err != nil {
+				t.Fatal(err)
+			}
+			testBDS(t, prv, 1<<uint(h), false)
+		}
+	}
+}
+
+// TestBDSRebuild starts signing at every index, as with a key without
+// traversal state, and signs into the next trees
+func TestBDSRebuild(t *testing.T) {
+	t.Parallel()
+	for _, v := range []struct{ h, d, k int }{{5, 1, 3}, {6, 3, 0}} {
+		gen, _ := testKey(t, v.h, v.d)
+		params := gen.params
+		for idx := uint64(0); idx < params.MaxSignatures(); idx++ {
+			key := make(PrivateXMSS, len(gen.prv))
+			copy(key, gen.prv)
+			copy(key[:params.indexBytes], indexToByte(idx, int(params.indexBytes)))
+			prv, err := NewPrivateKey(params, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := prv.SetBDS(v.k); err != nil {
+				t.Fatal(err)
+			}
+			testBDS(t, prv, 6, false)
+		}
+	}
+}
+
+func TestBDSMT(t *testing.T) {
+	t.Parallel()
+	for _, v := range []struct{ h, d, k int }{{4, 2, 0}, {4, 2, 2}, {6, 3, 0}, {6, 3, 2}, {8, 2, 2}} {
+		prv, _ := testKey(t, v.h, v.d)
+		if err := prv.SetBDS(v.k); err != nil {
+			t.Fatal(err)
+		}
+		testBDS(t, prv, 1<<uint(v.h), false)
+	}
+}
+
+func TestSetBDS(t *testing.T) {
+	params, err := NewParams(SHA2, 32, 16, 5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prv, err := NewPrivateKey(params, make(PrivateXMSS, params.prvBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []int{-1, 0, 2, 6} {
+		if err := prv.SetBDS(k); err == nil {
+			t.Errorf("SetBDS accepted k = %d for tree height 5", k)
+		}
+	}
+	for _, k := range []int{1, 3, 5} {
+		if err := prv.SetBDS(k); err != nil {
+			t.Errorf("SetBDS(%d): %v", k, err)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package xmss
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// checkpointMagic starts every key generation checkpoint file
+var checkpointMagic = []byte("XMSSCKPT")
+
+// keygenCheckpoint is the state of a key generation between two leaves of
+// the top-most tree. For XMSS it includes the traversal state that is
+// collected during the pass, so that the resumed key signs without
+// computing the tree again.
+type keygenCheckpoint struct {
+	params *Params
+	seeds  []byte
+	st     *treeHashState
+	trav   *traversal
+}
+
+func newCheckpoint(params *Params, seeds []byte) *keygenCheckpoint {
+	c := &keygenCheckpoint{
+		params: params,
+		seeds:  seeds,
+		st:     newTreeHashState(params, 0, params.treeHeight),
+	}
+	if params.d == 1 {
+		c.trav, _ = newTraversal(params, defaultBDSK(params))
+	}
+	return c
+}
+
+// bdsNodes returns the node arrays of the traversal state, in the order they
+// are stored
+func (c *keygenCheckpoint) bdsNodes() [][]byte {
+	if c.trav == nil {
+		return nil
+	}
+	s := c.trav.layers[0]
+	nodes := [][]byte{s.auth, s.keep, s.retain}
+	for i := range s.treehash {
+		nodes = append(nodes, s.treehash[i].node)
+	}
+	return nodes
+}
+
+// marshal encodes the checkpoint as
+// [magic || name length || name || k || key derivation || seeds || next leaf ||
+// stack size || heights || stack || traversal nodes || SHA-256 of the
+// preceding bytes], where k is the BDS parameter of XMSS and 0 for XMSS^MT
+func (c *keygenCheckpoint) marshal() []byte {
+	n := uint32(c.params.n)
+	b := append([]byte(nil), checkpointMagic...)
+	b = append(b, byte(len(c.params.name)))
+	b = append(b, c.params.name...)
+	k := byte(0)
+	if c.trav != nil {
+		k = byte(c.trav.k)
+	}
+	b = append(b, k, byte(c.params.keygen))
+	b = append(b, c.seeds...)
+	b = c.st.marshal(b, n)
+	for _, nodes := range c.bdsNodes() {
+		b = append(b, nodes...)
+	}
+	digest := sha256.Sum256(b)
+	return append(b, digest[:]...)
+}
+
+// parseCheckpoint decodes a checkpoint written by marshal for params
+func parseCheckpoint(params *Params, b []byte) (*keygenCheckpoint, error) {
+	if len(b) < sha256.Size {
+		return nil, ErrCheckpointCorrupt
+	}
+	digest := sha256.Sum256(b[:len(b)-sha256.Size])
+	if !bytes.Equal(digest[:], b[len(b)-sha256.Size:]) {
+		return nil, ErrCheckpointCorrupt
+	}
+	b = b[:len(b)-sha256.Size]
+
+	if !bytes.HasPrefix(b, checkpointMagic) || len(b) < len(checkpointMagic)+1 {
+		return nil, ErrCheckpointCorrupt
+	}
+	b = b[len(checkpointMagic):]
+	nameLen := int(b[0])
+	if len(b) < 1+nameLen+2 {
+		return nil, ErrCheckpointCorrupt
+	}
+	if name := string(b[1 : 1+nameLen]); name != params.name {
+		return nil, fmt.Errorf("xmss: checkpoint is for %s, not %s", name, params.name)
+	}
+	k := int(b[1+nameLen])
+	// The seeds give another key under another key derivation
+	if kd := KeyDerivation(b[1+nameLen+1]); kd != params.keygen {
+		return nil, fmt.Errorf("xmss: checkpoint is for %v key derivation, not %v", kd, params.keygen)
+	}
+	b = b[1+nameLen+2:]
+
+	n := uint32(params.n)
+	if len(b) < int(3*n) {
+		return nil, ErrCheckpointCorrupt
+	}
+	c := newCheckpoint(params, append([]byte(nil), b[:3*n]...))
+	b = b[3*n:]
+	if c.trav != nil && k != int(c.trav.k) {
+		if c.trav, _ = newTraversal(params, k); c.trav == nil {
+			return nil, ErrCheckpointCorrupt
+		}
+	}
+	d := &stateDecoder{b: b, ok: true}
+	c.st.unmarshal(d, n)
+	for _, nodes := range c.bdsNodes() {
+		d.bytes(nodes)
+	}
+	if !d.ok || len(d.b) != 0 {
+		return nil, ErrCheckpointCorrupt
+	}
+	return c, nil
+}
+
+// GenerateKeyCheckpoint is GenerateKeyContext that keeps the state of the
+// computation in a checkpoint file at path, so that it survives a crash. If
+// path does not exist, the seeds are read from random and saved to path
+// right away. Otherwise the computation resumes from the checkpoint at path
+// and random is not read. The resumed key is identical to the one an
+// uninterrupted run returns.
+//
+// The checkpoint is written with permissions 0600 whenever interval has
+// passed since the last one, and when ctx is done. It holds the seeds of the
+// key and must be protected like the key itself. Once the key is complete,
+// the file is removed. The tree is computed by a single goroutine.
+func GenerateKeyCheckpoint(ctx context.Context, params *Params, random io.Reader, path string, interval time.Duration, progress Progress) (*PrivateKey, error) {
+	n := uint32(params.n)
+	var c *keygenCheckpoint
+	b, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		seeds := make([]byte, 3*n)
+		if _, err := io.ReadFull(random, seeds); err != nil {
+			return nil, ErrEntropy
+		}
+		c = newCheckpoint(params, seeds)
+		if err := writeFileAtomic(path, c.marshal()); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		if c, err = parseCheckpoint(params, b); err != nil {
+			return nil, err
+		}
+	}
+
+	hs := newHasher(params, c.seeds[:n], c.seeds[2*n:])
+	hs.prog = newProgress(ctx, progress)
+	hs.prog.expect(1 << params.treeHeight)
+	hs.prog.done = uint64(c.st.next)
+	visit := func(height, index uint32, node []byte) {}
+	if c.trav != nil {
+		// Resetting the state keeps the nodes restored from the checkpoint
+		visit = c.trav.layers[0].startBuild(params, 0)
+	}
+
+	var topTreeA address
+	topTreeA.setLayerAddr(uint32(params.d) - 1)
+	last := time.Now()
+	err = c.st.run(hs, topTreeA, 1<<params.treeHeight, visit, func() error {
+		if time.Since(last) < interval {
+			return nil
+		}
+		last = time.Now()
+		return writeFileAtomic(path, c.marshal())
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			if err := writeFileAtomic(path, c.marshal()); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	prv := make(PrivateXMSS, params.prvBytes)
+	copy(prv[params.indexBytes:], c.seeds)
+	copy(prv[params.indexBytes+3*n:], c.st.stack[:n])
+	key := &PrivateKey{params: params, prv: prv, trav: c.trav}
+	if key.trav != nil {
+		key.trav.ready = true
+	}
+
+	// The checkpoint holds the seeds, so it must not outlive the key. If it
+	// cannot be removed, the next call completes from it instantly. A removal
+	// that is lost in a crash leaves the complete checkpoint behind, so the
+	// error of syncing the directory is not worth losing the key over.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	syncDir(filepath.Dir(path))
+	return key, nil
+}
@@ -0,0 +1,120 @@
+package xmss
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateKeyCheckpoint(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "xmss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, v := range []struct{ h, d int }{{5, 1}, {10, 2}} {
+		params, err := NewParams(SHA2, 32, 16, v.h, v.d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seeds := bytes.Repeat([]byte{3}, 3*params.n)
+		want, err := GenerateKey(params, bytes.NewReader(seeds))
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%d_%d.ckpt", v.h, v.d))
+		leaves := uint64(1) << params.treeHeight
+		// A stale temporary file of the old naming scheme must not be reused
+		if err := ioutil.WriteFile(path+".tmp", nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Keep the checkpoint written after leaf 9 as if the process had
+		// died there, and cancel after leaf 20
+		var crashed []byte
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err = GenerateKeyCheckpoint(ctx, params, bytes.NewReader(seeds), path, 0, func(done, total uint64) {
+			if done == 10 {
+				if crashed, err = ioutil.ReadFile(path); err != nil {
+					t.Error(err)
+				}
+			}
+			if done == 20 {
+				cancel()
+			}
+		})
+		if err != context.Canceled {
+			t.Fatalf("%s: cancelled key generation returned %v", params.name, err)
+		}
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+			t.Fatalf("%s: checkpoint %v, %v", params.name, info, err)
+		}
+		if stale, err := ioutil.ReadFile(path + ".tmp"); err != nil || len(stale) != 0 {
+			t.Errorf("%s: stale temporary file was written: %v", params.name, err)
+		}
+
+		// Resume after the cancellation, which must not read random
+		first := uint64(0)
+		prv, err := GenerateKeyCheckpoint(context.Background(), params, nil, path, 0, func(done, total uint64) {
+			if first == 0 {
+				first = done
+			}
+			if total != leaves {
+				t.Errorf("%s: resumed generation reports %d leaves", params.name, total)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first != 21 {
+			t.Errorf("%s: resumed at leaf %d, expected 21", params.name, first)
+		}
+		if !bytes.Equal(prv.prv, want.prv) {
+			t.Errorf("%s: resumed key differs", params.name)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: checkpoint was not removed: %v", params.name, err)
+		}
+
+		// Resume after the crash, the key must sign like a fresh one
+		if err := ioutil.WriteFile(path, crashed, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if prv, err = GenerateKeyCheckpoint(context.Background(), params, nil, path, 0, nil); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(prv.prv, want.prv) {
+			t.Errorf("%s: key resumed after a crash differs", params.name)
+		}
+		// For XMSS the checkpoint carries the traversal state
+		testBDS(t, prv, 3, params.d == 1)
+
+		// The seeds give another key under another key derivation
+		if err := ioutil.WriteFile(path, crashed, 0600); err != nil {
+			t.Fatal(err)
+		}
+		other, err := params.WithKeyDerivation(KeyDerivationSP800208)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GenerateKeyCheckpoint(context.Background(), other, nil, path, 0, nil); err == nil || err == ErrCheckpointCorrupt {
+			t.Errorf("%s: checkpoint was resumed with another key derivation: %v", params.name, err)
+		}
+
+		// A damaged checkpoint is rejected
+		crashed[len(crashed)/2] ^= 1
+		if err := ioutil.WriteFile(path, crashed, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GenerateKeyCheckpoint(context.Background(), params, nil, path, 0, nil); err != ErrCheckpointCorrupt {
+			t.Errorf("%s: damaged checkpoint returned %v", params.name, err)
+		}
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,36 @@
+package xmss
+
+import "errors"
+
+var (
+	// ErrInvalidSignature is returned when a signature does not verify
+	ErrInvalidSignature = errors.New("xmss: invalid signature")
+	// ErrInvalidSignatureLength is returned for signatures that are shorter
+	// than the parameter set's signature length
+	ErrInvalidSignatureLength = errors.New("xmss: invalid signature length")
+	// ErrInvalidMessageBuffer is returned when the buffer for the recovered
+	// message does not have the length of the signed message
+	ErrInvalidMessageBuffer = errors.New("xmss: invalid message buffer length")
+	// ErrInvalidPublicKey is returned for public keys of the wrong length
+	ErrInvalidPublicKey = errors.New("xmss: invalid public key")
+	// ErrInvalidPrivateKey is returned for private keys of the wrong length
+	ErrInvalidPrivateKey = errors.New("xmss: invalid private key")
+	// ErrKeyExhausted is returned when every one-time signature of a private
+	// key has been used
+	ErrKeyExhausted = errors.New("xmss: private key exhausted")
+	// ErrEntropy is returned when the random source fails during key generation
+	ErrEntropy = errors.New("xmss: reading entropy failed")
+	// ErrTreeCacheMismatch is returned for a tree cache that belongs to
+	// another key
+	ErrTreeCacheMismatch = errors.New("xmss: tree cache does not match the key")
+	// ErrTreeCacheCorrupt is returned when the nodes of a tree cache do not
+	// hash to the roots they are stored with
+	ErrTreeCacheCorrupt = errors.New("xmss: tree cache is corrupt")
+	// ErrCheckpointCorrupt is returned for a key generation checkpoint that
+	// is damaged or was not written by GenerateKeyCheckpoint
+	ErrCheckpointCorrupt = errors.New("xmss: key generation checkpoint is corrupt")
+	// ErrRootMismatch is returned when the trees computed from the seeds of a
+	// private key do not have the key's root, e.g. because the key was
+	// generated with another KeyDerivation than the one of its Params
+	ErrRootMismatch = errors.New("xmss: private key seeds do not match its root")
+)
@@ -1,72 +1,253 @@
 package xmss
 
-import "crypto/sha256"
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding"
+	"hash"
+)
 
-// PRF: SHA2-256(toByte(3, 32) || KEY || M)
+// newHash returns the hash function used by the parameter set.
+// For the SHA2 family n = 32 uses SHA-256 and n = 64 uses SHA-512, the
+// SHAKE functions produce exactly n bytes of output. For n = 24 the SHA-256
+// output is truncated by the callers copying n bytes.
+func newHash(params *Params) hash.Hash {
+	switch params.hash {
+	case SHAKE128:
+		return newShake128(params.n)
+	case SHAKE256:
+		return newShake256(params.n)
+	}
+	if params.n == 64 {
+		return sha512.New()
+	}
+	return sha256.New()
+}
+
+// Domain separators of the hash functions, which start their input as
+// toByte(x, padding)
+const (
+	domainF   = 0
+	domainH   = 1
+	domainMsg = 2
+	domainPRF = 3
+	// domainKeygen is PRF_keygen of NIST SP 800-208
+	domainKeygen = 4
+)
+
+// resumableHash is a hash function whose state can be saved and restored.
+// The hashes returned by newHash implement it.
+type resumableHash interface {
+	hash.Hash
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// binaryAppender is implemented by hashes that can save their state without
+// allocating
+type binaryAppender interface {
+	AppendBinary(b []byte) ([]byte, error)
+}
+
+// hasher is the hashing context of a single goroutine. It reuses one hash
+// function and its scratch buffers for every call, so that hashing does not
+// allocate. Each goroutine needs its own hasher, see clone.
+//
+// Most hashes are PRF calls keyed with pubSeed or prvSeed, whose input starts
+// with toByte(3, padding) || key. For SHA-256 with n = 32 and for SHA-512
+// that prefix is exactly one block. The hasher saves the state after the
+// prefix (the midstate) once and restores it instead of compressing the same
+// block again, which halves the work of every keyed PRF call.
+type hasher struct {
+	params   *Params
+	h        resumableHash
+	prvSeed  []byte
+	pubSeed  []byte
+	prvState []byte
+	pubState []byte
+	// keygenState is the midstate of PRF_keygen after toByte(4, padding) ||
+	// prvSeed || pubSeed, for KeyDerivationSP800208
+	keygenState []byte
+	seedKey     []byte
+	seedMid     []byte
+	// prog is checked and updated for every leaf of a tree, it may be nil
+	prog *progress
+	// lanes computes the WOTS chains for SHA-256 with n = 32 if there is a
+	// fast lane backend, see defaultLanes
+	lanes *chainLanes
+
+	padding [5][]byte
+	addr    []byte
+	ctr     []byte
+	mask    []byte
+	buf     []byte
+	sum     []byte
+}
+
+// newHasher returns a hasher for the key with the given seeds. prvSeed may be
+// nil if the hasher is only used for verification.
+func newHasher(params *Params, prvSeed, pubSeed []byte) *hasher {
+	n := params.n
+	hs := &hasher{
+		params:  params,
+		h:       newHash(params).(resumableHash),
+		prvSeed: prvSeed,
+		pubSeed: pubSeed,
+		addr:    make([]byte, 32),
+		ctr:     make([]byte, 32),
+		mask:    make([]byte, 2*n),
+		buf:     make([]byte, 3*n),
+		sum:     make([]byte, 0, 64),
+	}
+	for i := range hs.padding {
+		hs.padding[i] = toByte(i, params.paddingLen)
+	}
+	hs.pubState = hs.keyedState(nil, pubSeed)
+	if prvSeed != nil {
+		hs.prvState = hs.keyedState(nil, prvSeed)
+		if params.keygen == KeyDerivationSP800208 {
+			hs.keygenState = hs.midstate(nil, hs.padding[domainKeygen], prvSeed, pubSeed)
+		}
+	}
+	if params.hash == SHA2 && n == 32 && defaultLanes != nil {
+		hs.lanes = newChainLanes(pubSeed, *defaultLanes)
+	}
+	return hs
+}
+
+// clone returns a hasher with the same seeds and progress for use by another
+// goroutine
+func (hs *hasher) clone() *hasher {
+	c := newHasher(hs.params, hs.prvSeed, hs.pubSeed)
+	c.prog = hs.prog
+	return c
+}
+
+// keyedState appends the state of the hash function after absorbing
+// toByte(3, padding) || key to state
+func (hs *hasher) keyedState(state, key []byte) []byte {
+	return hs.midstate(state, hs.padding[domainPRF], key)
+}
+
+// midstate appends the state of the hash function after absorbing the
+// concatenation of parts to state
+func (hs *hasher) midstate(state []byte, parts ...[]byte) []byte {
+	hs.h.Reset()
+	for _, p := range parts {
+		hs.h.Write(p)
+	}
+	var err error
+	if a, ok := hs.h.(binaryAppender); ok {
+		state, err = a.AppendBinary(state)
+	} else {
+		var s []byte
+		s, err = hs.h.MarshalBinary()
+		state = append(state, s...)
+	}
+	if err != nil {
+		// The hashes of newHash always marshal
+		panic(err)
+	}
+	return state
+}
+
+// sumTo writes the first n bytes of the hash to out
+func (hs *hasher) sumTo(out []byte) {
+	hs.sum = hs.h.Sum(hs.sum[:0])
+	copy(out, hs.sum[:hs.params.n])
+}
+
+// PRF: HASH(toByte(3, n) || KEY || M)
 // Message must be exactly 32 bytes
-func hashPRF(params *Params, out, key, m []byte) {
-	h := sha256.New()
-	h.Write(toByte(3, params.n))
-	h.Write(key)
-	h.Write(m)
-	copy(out, h.Sum(nil))
+func (hs *hasher) prf(out, key, m []byte) {
+	hs.h.Reset()
+	hs.h.Write(hs.padding[domainPRF])
+	hs.h.Write(key)
+	hs.h.Write(m)
+	hs.sumTo(out)
+}
+
+// prfAddr computes PRF(KEY, a), resuming from the midstate of KEY
+func (hs *hasher) prfAddr(out, state []byte, a *address) {
+	if err := hs.h.UnmarshalBinary(state); err != nil {
+		panic(err)
+	}
+	a.toByte(hs.addr)
+	hs.h.Write(hs.addr)
+	hs.sumTo(out)
 }
 
-// H_msg: SHA2-256(toByte(2, 32) || KEY || M)
-// Computes the message hash using R, the public root, the index of the leaf
-// node, and the message.
-func hashMsg(params *Params, out, R, root, mPlus []byte, idx uint64) {
-	h := sha256.New()
-	copy(mPlus[:params.n], toByte(2, params.n))
-	copy(mPlus[params.n:2*params.n], R)
-	copy(mPlus[2*params.n:3*params.n], root)
-	copy(mPlus[3*params.n:4*params.n], toByte(int(idx), params.n))
-	h.Write(mPlus)
-	copy(out, h.Sum(nil))
+// prfSeed computes PRF(seed, toByte(i, 32)) for the expansion of a WOTS seed.
+// The midstate of the last seed is kept, as the len chains of a WOTS key are
+// expanded from the same seed.
+func (hs *hasher) prfSeed(out, seed []byte, i uint32) {
+	if hs.seedKey == nil || !bytes.Equal(hs.seedKey, seed) {
+		hs.seedKey = append(hs.seedKey[:0], seed...)
+		hs.seedMid = hs.keyedState(hs.seedMid[:0], seed)
+	}
+	if err := hs.h.UnmarshalBinary(hs.seedMid); err != nil {
+		panic(err)
+	}
+	hs.ctr[28], hs.ctr[29], hs.ctr[30], hs.ctr[31] = byte(i>>24), byte(i>>16), byte(i>>8), byte(i)
+	hs.h.Write(hs.ctr)
+	hs.sumTo(out)
 }
 
-// H: SHA2-256(toByte(1, 32) || KEY || M)
+// H_msg: HASH(toByte(2, n) || KEY || M)
+// Returns the hash for the message hash using R, the public root and the index
+// of the leaf node, which the message is written to. This allows the message
+// to be streamed instead of being held in memory.
+func newMsgHash(params *Params, R, root []byte, idx uint64) hash.Hash {
+	h := newHash(params)
+	h.Write(toByte(domainMsg, params.paddingLen))
+	h.Write(R)
+	h.Write(root)
+	h.Write(indexToByte(idx, params.n))
+	return h
+}
+
+// H: HASH(toByte(1, n) || KEY || M)
 // A cryptographic hash function H.  H accepts n-byte keys and byte
 // strings of length 2n and returns an n-byte string.
 // Includes: Algorithm 7: RAND_HASH
-func hashH(params *Params, out, seed, m []byte, a *address) {
-	h := sha256.New()
-	h.Write(toByte(1, params.n))
+// The key is PUB_SEED. out may overlap m.
+func (hs *hasher) hashH(out, m []byte, a *address) {
+	n := hs.params.n
 
 	// Generate the n-byte key
 	a.setKeyAndMask(0)
-	buf := make([]byte, 3*params.n)
-	hashPRF(params, buf[:params.n], seed, a.toByte())
+	hs.prfAddr(hs.buf[:n], hs.pubState, a)
 
 	// Generate the 2n-byte mask
 	a.setKeyAndMask(1)
-	bitmask := make([]byte, 2*params.n)
-	hashPRF(params, bitmask[:params.n], seed, a.toByte())
+	hs.prfAddr(hs.mask[:n], hs.pubState, a)
 	a.setKeyAndMask(2)
-	hashPRF(params, bitmask[params.n:], seed, a.toByte())
-
-	xor(buf[params.n:], m, bitmask)
-	h.Write(buf)
+	hs.prfAddr(hs.mask[n:], hs.pubState, a)
 
-	copy(out, h.Sum(nil))
+	xor(hs.buf[n:], m, hs.mask)
+	hs.h.Reset()
+	hs.h.Write(hs.padding[domainH])
+	hs.h.Write(hs.buf)
+	hs.sumTo(out)
 }
 
-// F: SHA2-256(toByte(0, 32) || KEY || M)
-func hashF(params *Params, out, seed, m []byte, a *address) {
-	h := sha256.New()
-	h.Write(make([]byte, params.n))
+// F: HASH(toByte(0, n) || KEY || M)
+// The key is PUB_SEED. out may overlap m.
+func (hs *hasher) hashF(out, m []byte, a *address) {
+	n := hs.params.n
 
 	// Generate the n-byte key
 	a.setKeyAndMask(0)
-	buf := make([]byte, 2*params.n)
-	hashPRF(params, buf[:params.n], seed, a.toByte())
+	hs.prfAddr(hs.buf[:n], hs.pubState, a)
 
 	// Generate the n-byte mask
 	a.setKeyAndMask(1)
-	bitmask := make([]byte, params.n)
-	hashPRF(params, bitmask, seed, a.toByte())
-	xor(buf[params.n:], m, bitmask)
-	h.Write(buf)
+	hs.prfAddr(hs.mask[:n], hs.pubState, a)
 
-	copy(out, h.Sum(nil))
+	xor(hs.buf[n:2*n], m, hs.mask[:n])
+	hs.h.Reset()
+	hs.h.Write(hs.padding[domainF])
+	hs.h.Write(hs.buf[:2*n])
+	hs.sumTo(out)
 }
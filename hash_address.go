@@ -74,12 +74,12 @@ func (a *address) setTreeIndex(idx uint32) {
 	a[6] = idx
 }
 
-func (a *address) toByte() (out []byte) {
-	out = make([]byte, len(a)*4)
-	j := 0
-	for i := 0; i < len(out); i += 4 {
-		copy(out[i:], uint32ToByte(a[j]))
-		j++
+// toByte writes the 32-byte big-endian encoding of a to out
+func (a *address) toByte(out []byte) {
+	for i, v := range a {
+		out[4*i] = byte(v >> 24)
+		out[4*i+1] = byte(v >> 16)
+		out[4*i+2] = byte(v >> 8)
+		out[4*i+3] = byte(v)
 	}
-	return
 }
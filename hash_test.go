@@ -0,0 +1,65 @@
+package xmss
+
+import (
+	"bytes"
+	"testing"
+)
+
+// refHashF computes F as written in RFC 8391, without midstates
+func refHashF(params *Params, m, pubSeed []byte, a *address) []byte {
+	prf := func(m []byte) []byte {
+		h := newHash(params)
+		h.Write(toByte(domainPRF, params.paddingLen))
+		h.Write(pubSeed)
+		h.Write(m)
+		return h.Sum(nil)[:params.n]
+	}
+	addr := make([]byte, 32)
+	a.setKeyAndMask(0)
+	a.toByte(addr)
+	key := prf(addr)
+	a.setKeyAndMask(1)
+	a.toByte(addr)
+	mask := prf(addr)
+
+	h := newHash(params)
+	h.Write(toByte(domainF, params.paddingLen))
+	h.Write(key)
+	for i := range mask {
+		mask[i] ^= m[i]
+	}
+	h.Write(mask)
+	return h.Sum(nil)[:params.n]
+}
+
+func TestHasher(t *testing.T) {
+	for _, v := range []struct {
+		hash HashFunc
+		n    int
+	}{{SHA2, 24}, {SHA2, 32}, {SHA2, 64}, {SHAKE128, 32}, {SHAKE256, 64}} {
+		params, err := NewParams(v.hash, v.n, 16, 4, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := params.String()
+		seed := bytes.Repeat([]byte{7}, params.n)
+		m := bytes.Repeat([]byte{9}, params.n)
+		var a address
+		a.initRandom()
+
+		hs := newHasher(params, seed, seed)
+		out := make([]byte, params.n)
+		hs.hashF(out, m, &a)
+		if want := refHashF(params, m, seed, &a); !bytes.Equal(out, want) {
+			t.Errorf("%s: F differs from the reference", name)
+		}
+		pair := make([]byte, 2*params.n)
+		if allocs := testing.AllocsPerRun(100, func() {
+			hs.hashF(out, out, &a)
+			hs.hashH(out, pair, &a)
+			hs.prfSeed(out, seed, 1)
+		}); allocs != 0 {
+			t.Errorf("%s: hashing allocates %v times", name, allocs)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package xmss
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// katDir holds the known-answer vectors of tools/katgen/vectors.txt in the
+// formats of the reference implementation. tools/katgen/reference.sh
+// generates them with xmss-reference and records its commit in UPSTREAM,
+// tools/katgen/xmss_kat.py checks them against an independent Python
+// transcription of RFC 8391 and NIST SP 800-208.
+const katDir = dataDir + "/kat"
+
+// katVectors are the parameter sets of the vectors in katDir, keyed by file
+// name. Every private key derives its WOTS+ keys with PRF_keygen.
+var katVectors = map[string]*Params{
+	"SHA2_10_256":     SHA2_10_256,
+	"SHA2_10_512":     SHA2_10_512,
+	"SHAKE_10_256":    SHAKE_10_256,
+	"SHA2_10_192":     SHA2_10_192,
+	"SHAKE256_10_192": SHAKE256_10_192,
+	"SHA2_20_4_256":   SHA2_20_4_256,
+}
+
+// readKAT returns the message, the OID-prefixed private and public key and
+// the detached signature of the vector name
+func readKAT(t *testing.T, name string) (msg, key, pub, sig []byte) {
+	var files [4][]byte
+	for i, file := range []string{"message_data", name + ".key", name + ".pub", name + ".sig"} {
+		b, err := ioutil.ReadFile(katDir + "/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[i] = b
+	}
+	return files[0], files[1], files[2], files[3]
+}
+
+func TestKAT(t *testing.T) {
+	t.Parallel()
+	if upstream, err := ioutil.ReadFile(katDir + "/UPSTREAM"); err == nil {
+		t.Logf("Vectors of xmss-reference %s", bytes.TrimSpace(upstream))
+	} else {
+		t.Log("Vectors without an xmss-reference commit, run tools/katgen/reference.sh")
+	}
+	for name, params := range katVectors {
+		name, params := name, params
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			msg, key, raw, sig := readKAT(t, name)
+			parse := ParsePublicKey
+			if params.d > 1 {
+				parse = ParsePublicKeyMT
+			}
+			pub, err := parse(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pub.Params() != params {
+				t.Fatalf("Public key has parameter set %s", pub.Params().Name())
+			}
+			if err := VerifyDetached(pub, msg, sig); err != nil {
+				t.Fatalf("Reference signature does not verify: %v", err)
+			}
+
+			parsePrv := ParsePrivateKey
+			if params.d > 1 {
+				parsePrv = ParsePrivateKeyMT
+			}
+			prv, err := parsePrv(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(prv.PublicKey().Bytes(), pub.Bytes()) {
+				t.Error("Public key of the parsed private key does not match")
+			}
+			enc, err := prv.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(enc, key) {
+				t.Error("Encoding of the parsed key differs from the reference key")
+			}
+			own, err := prv.SignDetached(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(own, sig) {
+				t.Error("Signature does not match the reference signature")
+			}
+		})
+	}
+}
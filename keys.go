@@ -0,0 +1,575 @@
+package xmss
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// oidBytes is the length of the big-endian OID prefix of encoded keys
+const oidBytes = 4
+
+// PublicKey is a public key bound to its parameter set
+type PublicKey struct {
+	params *Params
+	pub    PublicXMSS
+}
+
+// PrivateKey is a private key bound to its parameter set. Its signing
+// methods are safe for concurrent use.
+type PrivateKey struct {
+	params *Params
+	prv    PrivateXMSS
+
+	mu    sync.Mutex
+	store StateStore
+	// limit is the index committed to store. Indices below it are reserved
+	// and can be used without another commit.
+	limit      uint64
+	lowWater   uint64
+	onLowWater func(remaining uint64)
+	// trav is the BDS traversal state of the key, created on first use or
+	// loaded from a TraversalStore
+	trav  *traversal
+	cache *TreeCache
+}
+
+// NewPublicKey binds a raw public key [root || pubSeed] to its parameter set
+func NewPublicKey(params *Params, pub PublicXMSS) (*PublicKey, error) {
+	if len(pub) != int(params.pubBytes) {
+		return nil, ErrInvalidPublicKey
+	}
+	return &PublicKey{params: params, pub: pub}, nil
+}
+
+// NewPrivateKey binds a raw private key as returned by GenerateXMSSKeypair to
+// its parameter set. The key is not copied, signing with it updates prv.
+func NewPrivateKey(params *Params, prv PrivateXMSS) (*PrivateKey, error) {
+	if len(prv) != int(params.prvBytes) {
+		return nil, ErrInvalidPrivateKey
+	}
+	return &PrivateKey{params: params, prv: prv}, nil
+}
+
+// Params returns the parameter set of the key
+func (pub *PublicKey) Params() *Params {
+	return pub.params
+}
+
+// Bytes returns the public key without an OID, i.e. [root || pubSeed]
+func (pub *PublicKey) Bytes() PublicXMSS {
+	return pub.pub
+}
+
+// Equal reports whether pub and x are the same public key of the same
+// parameter set. Together with PrivateKey.Public it makes *PublicKey usable
+// wherever the standard library expects a crypto.PublicKey.
+func (pub *PublicKey) Equal(x crypto.PublicKey) bool {
+	other, ok := x.(*PublicKey)
+	if !ok {
+		return false
+	}
+	return pub.params.name == other.params.name && bytes.Equal(pub.pub, other.pub)
+}
+
+// Verify checks an attached signature as returned by PrivateXMSS.Sign, see Verify
+func (pub *PublicKey) Verify(m, signature []byte) bool {
+	return Verify(pub.params, m, signature, pub.pub)
+}
+
+// VerifyDetached checks a signature as returned by PrivateKey.SignDetached
+// over msg. The signature must be exactly pub.Params().SignBytes() bytes long.
+func VerifyDetached(pub *PublicKey, msg, signature []byte) error {
+	return VerifyReader(pub, bytes.NewReader(msg), signature)
+}
+
+// VerifyReader checks a detached signature over the message read from r
+// until EOF. The message is hashed as it is read and never held in memory.
+func VerifyReader(pub *PublicKey, r io.Reader, signature []byte) error {
+	if len(pub.pub) != int(pub.params.pubBytes) {
+		return ErrInvalidPublicKey
+	}
+	if len(signature) != int(pub.params.signBytes) {
+		return ErrInvalidSignatureLength
+	}
+	return verifyReader(pub.params, r, signature, pub.pub)
+}
+
+// Open verifies an attached signature as returned by PrivateKey.SignMessage
+// and appends the signed message to out, like sign.Open of
+// golang.org/x/crypto/nacl/sign. signedMessage is not modified and the
+// message is copied, so the result only aliases out. Pass nil as out to
+// have the message allocated. On failure out is returned unchanged together
+// with the error.
+func Open(out, signedMessage []byte, pub *PublicKey) ([]byte, error) {
+	if len(pub.pub) != int(pub.params.pubBytes) {
+		return out, ErrInvalidPublicKey
+	}
+	signBytes := int(pub.params.signBytes)
+	if len(signedMessage) < signBytes {
+		return out, ErrInvalidSignatureLength
+	}
+	msg := signedMessage[signBytes:]
+	if err := verifyDetached(pub.params, msg, signedMessage[:signBytes], pub.pub); err != nil {
+		return out, err
+	}
+	return append(out, msg...), nil
+}
+
+// MarshalBinary encodes the public key as [OID || root || pubSeed], the
+// format used by the reference implementation
+func (pub *PublicKey) MarshalBinary() ([]byte, error) {
+	if pub.params.oid == 0 {
+		return nil, fmt.Errorf("xmss: %s has no OID", pub.params.name)
+	}
+	out := make([]byte, oidBytes+len(pub.pub))
+	binary.BigEndian.PutUint32(out, pub.params.oid)
+	copy(out[oidBytes:], pub.pub)
+	return out, nil
+}
+
+// ParsePublicKey decodes an OID-prefixed XMSS public key and selects the
+// parameter set from the OID
+func ParsePublicKey(b []byte) (*PublicKey, error) {
+	return parsePublicKey(b, ParamsByOID)
+}
+
+// ParsePublicKeyMT decodes an OID-prefixed XMSS^MT public key and selects the
+// parameter set from the OID
+func ParsePublicKeyMT(b []byte) (*PublicKey, error) {
+	return parsePublicKey(b, ParamsMTByOID)
+}
+
+func parsePublicKey(b []byte, lookup func(uint32) (*Params, error)) (*PublicKey, error) {
+	if len(b) < oidBytes {
+		return nil, ErrInvalidPublicKey
+	}
+	params, err := lookup(binary.BigEndian.Uint32(b))
+	if err != nil {
+		return nil, err
+	}
+	pub := make(PublicXMSS, len(b)-oidBytes)
+	copy(pub, b[oidBytes:])
+	return NewPublicKey(params, pub)
+}
+
+// Params returns the parameter set of the key
+func (prv *PrivateKey) Params() *Params {
+	return prv.params
+}
+
+// Key returns the underlying private key in the layout of
+// GenerateXMSSKeypair. It is not a copy, signing with it updates prv.
+func (prv *PrivateKey) Key() PrivateXMSS {
+	return prv.prv
+}
+
+// Index returns the index of the next one-time key
+func (prv *PrivateKey) Index() uint64 {
+	prv.mu.Lock()
+	defer prv.mu.Unlock()
+	return prv.prv.Index(prv.params)
+}
+
+// Remaining returns the number of signatures the key can still create
+func (prv *PrivateKey) Remaining() uint64 {
+	prv.mu.Lock()
+	defer prv.mu.Unlock()
+	return prv.prv.Remaining(prv.params)
+}
+
+// LoadPrivateKey loads a private key for params from store and keeps
+// committing its state there, see SetStateStore. If store is a
+// TraversalStore, the key continues with the stored traversal state.
+func LoadPrivateKey(params *Params, store StateStore) (*PrivateKey, error) {
+	key, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	prv, err := NewPrivateKey(params, key)
+	if err != nil {
+		return nil, err
+	}
+	prv.store = store
+	prv.limit = prv.prv.Index(params)
+	if ts, ok := store.(TraversalStore); ok {
+		// A missing or damaged state is rebuilt by the first signature
+		if b, err := ts.LoadTraversal(); err == nil {
+			prv.trav = parseTraversal(params, prv.PublicKey().pub, b)
+		}
+	}
+	return prv, nil
+}
+
+// SetStateStore commits the current state of the key to store and makes
+// every later signature commit the advanced index before it is returned. A
+// crash can therefore lose an index, but never reuse one.
+func (prv *PrivateKey) SetStateStore(store StateStore) error {
+	prv.mu.Lock()
+	defer prv.mu.Unlock()
+	if err := store.Commit(prv.prv); err != nil {
+		return err
+	}
+	prv.store = store
+	prv.limit = prv.prv.Index(prv.params)
+	return prv.commitTraversal()
+}
+
+// Reserve commits an index k signatures ahead with a single write, so that
+// the next k signatures are created without touching the StateStore. Indices
+// that are reserved but unused when the process stops are skipped after a
+// restart, they are never reused. Reserving while a reservation is active
+// extends it. Without a StateStore, Reserve has no effect.
+func (prv *PrivateKey) Reserve(k uint64) error {
+	prv.mu.Lock()
+	defer prv.mu.Unlock()
+	if prv.store == nil {
+		return nil
+	}
+	if err := prv.reserve(k); err != nil {
+		return err
+	}
+	return prv.commitTraversal()
+}
+
+// Reserved returns the number of reserved indices that have not been used
+// yet. They are lost if the process stops now, and are not counted by the
+// Remaining of a key loaded from the StateStore.
+func (prv *PrivateKey) Reserved() uint64 {
+	prv.mu.Lock()
+	defer prv.mu.Unlock()
+	idx := prv.prv.Index(prv.params)
+	if prv.store == nil || prv.limit < idx {
+		return 0
+	}
+	return prv.limit - idx
+}
+
+// SetLowWaterMark registers fn to be called after every signature that leaves
+// threshold or fewer signatures, so that the key can be rotated in time. fn
+// is called after the key is unlocked, so it may use prv, and is called
+// concurrently by concurrent signatures. A nil fn disables it.
+func (prv *PrivateKey) SetLowWaterMark(threshold uint64, fn func(remaining uint64)) {
+	prv.mu.Lock()
+	defer prv.mu.Unlock()
+	prv.lowWater = threshold
+	prv.onLowWater = fn
+}
+
+// SignMessage signs m with the next one-time key and returns the signature
+// followed by the message. It returns ErrKeyExhausted once all one-time keys
+// are used.
+func (prv *PrivateKey) SignMessage(m []byte) (SignatureXMSS, error) {
+	return prv.SignMessageContext(context.Background(), m, nil)
+}
+
+// SignMessageContext is SignMessage that can be cancelled through ctx and
+// reports the leaves computed so far to progress, which may be nil. Signing
+// only computes whole trees when the key has no usable traversal state: for
+// the first signature of a key from NewPrivateKey, or loaded from a
+// StateStore that is not a TraversalStore, after SetBDS, and after the index
+// was moved far past the state. It then reports d * 2^(h/d) leaves, plus
+// 2^(h/d) for every next tree that is needed soon. Once ctx is done its error
+// is returned. The index has already been advanced then, the one-time key is
+// never used.
+func (prv *PrivateKey) SignMessageContext(ctx context.Context, m []byte, progress Progress) (SignatureXMSS, error) {
+	signBytes := prv.params.signBytes
+	signature := make(SignatureXMSS, int(signBytes)+len(m))
+	copy(signature[signBytes:], m)
+	if err := prv.sign(signature[:signBytes], bytes.NewReader(m), newProgress(ctx, progress)); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// SignDetached signs msg with the next one-time key and returns a signature
+// of exactly Params().SignBytes() bytes, without the message
+func (prv *PrivateKey) SignDetached(msg []byte) ([]byte, error) {
+	return prv.SignReader(bytes.NewReader(msg))
+}
+
+// SignReader signs the message read from r until EOF like SignDetached. The
+// message is hashed as it is read and never held in memory. Its index is
+// claimed before r is read, and prv is not locked while reading, so a slow
+// reader does not hold up other signatures. If reading fails, the error is
+// returned and the one-time key of the claimed index is never used.
+func (prv *PrivateKey) SignReader(r io.Reader) ([]byte, error) {
+	signature := make([]byte, prv.params.signBytes)
+	if err := prv.sign(signature, r, nil); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// sign writes a detached signature over the message read from r to
+// signature and calls the low-water mark callback if it is due. prv is only
+// locked to claim the index, the message is read and signed afterwards.
+func (prv *PrivateKey) sign(signature []byte, r io.Reader, prog *progress) error {
+	prv.mu.Lock()
+	p, err := prv.claimLocked(signature, prog)
+	var lowWater func()
+	if err == nil {
+		lowWater = prv.lowWaterCall()
+	}
+	prv.mu.Unlock()
+	if lowWater != nil {
+		lowWater()
+	}
+	if err != nil {
+		return err
+	}
+	return p.finish(r)
+}
+
+// claimLocked claims the next index for a signature with prv locked. It
+// commits the index to the StateStore first if it is not reserved yet. prog
+// may be nil.
+func (prv *PrivateKey) claimLocked(signature []byte, prog *progress) (*pendingSignature, error) {
+	reserved := false
+	if prv.store != nil && prv.prv.Index(prv.params) >= prv.limit {
+		if err := prv.reserve(1); err != nil {
+			return nil, err
+		}
+		reserved = true
+	}
+	var s layerSigner = prv.cache
+	if prv.cache == nil {
+		if prv.trav == nil {
+			prv.trav, _ = newTraversal(prv.params, defaultBDSK(prv.params))
+		}
+		s = prv.trav
+	}
+	p, err := prv.prv.claim(prv.params, signature, s, prog)
+	if err != nil {
+		return nil, err
+	}
+	if reserved {
+		// The traversal state is stored along with the key. It only saves
+		// time after a restart, so the signature is not lost over it.
+		prv.commitTraversal()
+	}
+	return p, nil
+}
+
+// SetBDS sets the parameter k of the BDS tree traversal the key signs with.
+// Signing keeps 2^k - k - 1 nodes near the root of every tree it uses and
+// computes about (h - k) / 2 + 2 leaves per signature, where h is
+// Params().TreeHeight(). h - k must be even, the default is k = h mod 2.
+// Changing k discards the traversal state, the next signature rebuilds it
+// with one pass over the current tree of every layer.
+func (prv *PrivateKey) SetBDS(k int) error {
+	prv.mu.Lock()
+	defer prv.mu.Unlock()
+	if prv.trav != nil && int(prv.trav.k) == k {
+		return nil
+	}
+	trav, err := newTraversal(prv.params, k)
+	if err != nil {
+		return err
+	}
+	prv.trav = trav
+	return nil
+}
+
+// SetTreeCache makes the key read its authentication paths from c instead of
+// using BDS traversal. Signing then costs the same at every index, even if
+// the index of Key() is changed externally. If a path read from c does not
+// match the root of its tree, signing fails with ErrTreeCacheCorrupt and the
+// one-time key is not used again. A nil c returns to BDS traversal.
+func (prv *PrivateKey) SetTreeCache(c *TreeCache) error {
+	prv.mu.Lock()
+	defer prv.mu.Unlock()
+	if c != nil && !c.belongsTo(prv) {
+		return ErrTreeCacheMismatch
+	}
+	prv.cache = c
+	return nil
+}
+
+// defaultBDSK returns the smallest valid BDS parameter for params
+func defaultBDSK(params *Params) int {
+	return int(params.treeHeight % 2)
+}
+
+// reserve durably stores the key with its index advanced k past the current
+// reservation. The index of the key in memory is left unchanged, signing
+// consumes the reserved indices up to limit.
+func (prv *PrivateKey) reserve(k uint64) error {
+	idx := prv.prv.Index(prv.params)
+	max := prv.params.MaxSignatures()
+	if idx >= max {
+		return ErrKeyExhausted
+	}
+	start := prv.limit
+	if start < idx {
+		start = idx
+	}
+	limit := start + k
+	if limit > max || limit < start {
+		limit = max
+	}
+	next := make(PrivateXMSS, len(prv.prv))
+	copy(next, prv.prv)
+	next.setIndex(prv.params, limit)
+	if err := prv.store.Commit(next); err != nil {
+		return err
+	}
+	prv.limit = limit
+	return nil
+}
+
+// commitTraversal stores the traversal state if the StateStore keeps it
+func (prv *PrivateKey) commitTraversal() error {
+	ts, ok := prv.store.(TraversalStore)
+	if !ok || prv.trav == nil || !prv.trav.ready {
+		return nil
+	}
+	return ts.CommitTraversal(prv.trav.marshal(prv.params, prv.PublicKey().pub))
+}
+
+// lowWaterCall returns the call of the low-water mark callback with the
+// remaining signatures if it is due, or nil. It is read with prv locked and
+// called once prv is unlocked.
+func (prv *PrivateKey) lowWaterCall() func() {
+	fn := prv.onLowWater
+	if fn == nil {
+		return nil
+	}
+	remaining := prv.prv.Remaining(prv.params)
+	if remaining > prv.lowWater {
+		return nil
+	}
+	return func() { fn(remaining) }
+}
+
+// PublicKey returns the public key matching prv
+func (prv *PrivateKey) PublicKey() *PublicKey {
+	n := uint32(prv.params.n)
+	off := prv.params.indexBytes
+	pub := make(PublicXMSS, 2*n)
+	copy(pub[:n], prv.prv[off+3*n:off+4*n])
+	copy(pub[n:], prv.prv[off+2*n:off+3*n])
+	return &PublicKey{params: prv.params, pub: pub}
+}
+
+// Public returns the *PublicKey matching prv, see crypto.Signer
+func (prv *PrivateKey) Public() crypto.PublicKey {
+	return prv.PublicKey()
+}
+
+// Sign implements crypto.Signer. It signs digest with the next one-time key
+// like SignDetached and returns the detached signature. XMSS hashes the
+// message itself, so with opts.HashFunc() == crypto.Hash(0) digest is the
+// message. Otherwise digest must be a hash of the message computed with
+// opts.HashFunc(). It is signed as the message, so the signature verifies
+// with VerifyDetached over digest. rand is ignored, XMSS signatures are
+// deterministic.
+func (prv *PrivateKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if h := opts.HashFunc(); h != 0 && len(digest) != h.Size() {
+		return nil, fmt.Errorf("xmss: digest is %d bytes long, %v has %d bytes", len(digest), h, h.Size())
+	}
+	return prv.SignDetached(digest)
+}
+
+// MarshalBinary encodes the private key as
+// [OID || index || prvSeed || prfSeed || root || pubSeed], the format used by
+// the reference implementation. Note that root and pubSeed are swapped with
+// respect to the layout of GenerateXMSSKeypair. The format implies the
+// KeyDerivationSP800208 of the reference implementation, so keys with the
+// legacy key derivation are not encoded.
+func (prv *PrivateKey) MarshalBinary() ([]byte, error) {
+	if prv.params.oid == 0 {
+		return nil, fmt.Errorf("xmss: %s has no OID", prv.params.name)
+	}
+	if prv.params.keygen != KeyDerivationSP800208 {
+		return nil, fmt.Errorf("xmss: %s key with the %v key derivation has no reference encoding", prv.params.name, prv.params.keygen)
+	}
+	ref, err := ExportPrivateKey(prv.params, prv.prv)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, oidBytes+len(ref))
+	binary.BigEndian.PutUint32(out, prv.params.oid)
+	copy(out[oidBytes:], ref)
+	return out, nil
+}
+
+// ParsePrivateKey decodes an OID-prefixed XMSS private key in the format of
+// the reference implementation and selects the parameter set from the OID.
+// Like the reference implementation, the key derives its WOTS+ keys with
+// KeyDerivationSP800208, whatever the default of the parameter set is.
+func ParsePrivateKey(b []byte) (*PrivateKey, error) {
+	return parsePrivateKey(b, ParamsByOID)
+}
+
+// ParsePrivateKeyMT decodes an OID-prefixed XMSS^MT private key in the format
+// of the reference implementation and selects the parameter set from the OID,
+// with KeyDerivationSP800208 like ParsePrivateKey.
+func ParsePrivateKeyMT(b []byte) (*PrivateKey, error) {
+	return parsePrivateKey(b, ParamsMTByOID)
+}
+
+func parsePrivateKey(b []byte, lookup func(uint32) (*Params, error)) (*PrivateKey, error) {
+	if len(b) < oidBytes {
+		return nil, ErrInvalidPrivateKey
+	}
+	params, err := lookup(binary.BigEndian.Uint32(b))
+	if err != nil {
+		return nil, err
+	}
+	if params.keygen != KeyDerivationSP800208 {
+		if params, err = params.WithKeyDerivation(KeyDerivationSP800208); err != nil {
+			return nil, err
+		}
+	}
+	prv, err := ImportPrivateKey(params, b[oidBytes:])
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKey{params: params, prv: prv}, nil
+}
+
+// ExportPrivateKey converts prv from the layout of GenerateXMSSKeypair,
+// [index || prvSeed || prfSeed || pubSeed || root], to the layout of the
+// reference implementation, [index || prvSeed || prfSeed || root || pubSeed].
+// The result carries no OID. Both layouts use the same index width, 4 bytes
+// for XMSS and ceil(h / 8) bytes for XMSS^MT. liboqs stores the same layout
+// after the OID, as produced by PrivateKey.MarshalBinary.
+func ExportPrivateKey(params *Params, prv PrivateXMSS) ([]byte, error) {
+	if len(prv) != int(params.prvBytes) {
+		return nil, ErrInvalidPrivateKey
+	}
+	out := make([]byte, params.prvBytes)
+	swapRootAndPubSeed(params, out, prv)
+	return out, nil
+}
+
+// ImportPrivateKey converts a private key without an OID from the layout of
+// the reference implementation to the layout of this package. It is the
+// inverse of ExportPrivateKey. The reference implementation derives the
+// WOTS+ keys of every parameter set as NIST SP 800-208 does, so its keys
+// need params.WithKeyDerivation(KeyDerivationSP800208).
+func ImportPrivateKey(params *Params, b []byte) (PrivateXMSS, error) {
+	if len(b) != int(params.prvBytes) {
+		return nil, ErrInvalidPrivateKey
+	}
+	prv := make(PrivateXMSS, params.prvBytes)
+	swapRootAndPubSeed(params, prv, b)
+	return prv, nil
+}
+
+// swapRootAndPubSeed converts a private key between the layout of this
+// package, [index || prvSeed || prfSeed || pubSeed || root], and the layout of
+// the reference implementation, [index || prvSeed || prfSeed || root || pubSeed].
+// The conversion is its own inverse.
+func swapRootAndPubSeed(params *Params, out, in []byte) {
+	n := uint32(params.n)
+	off := params.indexBytes + 2*n
+	copy(out[:off], in[:off])
+	copy(out[off:off+n], in[off+n:off+2*n])
+	copy(out[off+n:off+2*n], in[off:off+n])
+}
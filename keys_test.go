@@ -0,0 +1,570 @@
+package xmss
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestKeyEncoding(t *testing.T) {
+	t.Parallel()
+	params, err := SHA2_20_4_256.WithKeyDerivation(KeyDerivationSP800208)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := params.n
+	off := int(params.indexBytes)
+	rawPrv, rawPub := GenerateXMSSKeypair(params)
+	prv, err := NewPrivateKey(params, *rawPrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub := prv.PublicKey()
+	if !bytes.Equal(pub.Bytes(), *rawPub) {
+		t.Fatal("Public key derived from the private key does not match")
+	}
+	encPub, err := pub.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encPub[:oidBytes], []byte{0, 0, 0, 2}) || !bytes.Equal(encPub[oidBytes:], *rawPub) {
+		t.Errorf("Unexpected public key encoding %x", encPub)
+	}
+	parsedPub, err := ParsePublicKeyMT(encPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsedPub.Params() != SHA2_20_4_256 || !bytes.Equal(parsedPub.Bytes(), *rawPub) {
+		t.Error("Parsed public key does not match")
+	}
+
+	encPrv, err := prv.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := encPrv[oidBytes:]
+	if !bytes.Equal(ref[off+2*n:off+3*n], (*rawPub)[:n]) || !bytes.Equal(ref[off+3*n:], (*rawPub)[n:]) {
+		t.Error("Private key encoding does not follow [index || prvSeed || prfSeed || root || pubSeed]")
+	}
+	parsedPrv, err := ParsePrivateKeyMT(encPrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsedPrv.Params().Name() != params.Name() || parsedPrv.Params().KeyDerivation() != KeyDerivationSP800208 ||
+		!bytes.Equal(parsedPrv.Key(), *rawPrv) {
+		t.Error("Parsed private key does not match")
+	}
+
+	msg := make([]byte, 32)
+	rand.Read(msg)
+	sig := *parsedPrv.Key().Sign(params, msg)
+	m := make([]byte, len(sig))
+	if !parsedPub.Verify(m, sig) {
+		t.Error("Signature by the parsed private key does not verify under the parsed public key")
+	}
+
+	if _, err := ParsePublicKeyMT(encPub[:len(encPub)-1]); err == nil {
+		t.Error("Truncated public key was accepted")
+	}
+	if _, err := ParsePrivateKeyMT(encPrv[:len(encPrv)-1]); err == nil {
+		t.Error("Truncated private key was accepted")
+	}
+	if _, err := ParsePublicKeyMT([]byte{0, 0, 1, 0}); err == nil {
+		t.Error("Unknown OID was accepted")
+	}
+	legacy, err := NewPrivateKey(SHA2_20_4_256, *rawPrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := legacy.MarshalBinary(); err == nil {
+		t.Error("Private key with the legacy key derivation was encoded")
+	}
+	custom, _ := NewParams(SHA2, 32, 4, 4, 1)
+	if _, err := (&PublicKey{params: custom, pub: make([]byte, 64)}).MarshalBinary(); err == nil {
+		t.Error("Public key without an OID was encoded")
+	}
+}
+
+func TestParsePublicKeyTestData(t *testing.T) {
+	t.Parallel()
+	msg, err := ioutil.ReadFile(dataDir + "/message_data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ioutil.ReadFile(dataDir + "/SHA2_10_256.pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := ioutil.ReadFile(dataDir + "/SHA2_10_256.sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ParsePublicKey(append([]byte{0, 0, 0, 1}, raw...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub.Params() != SHA2_10_256 {
+		t.Fatalf("Parsed public key has parameter set %s", pub.Params().Name())
+	}
+	m := make([]byte, pub.Params().SignBytes()+len(msg))
+	if !pub.Verify(m, sig) {
+		t.Error("Verification with the parsed public key does not match")
+	}
+}
+
+func TestReferencePrivateKey(t *testing.T) {
+	t.Parallel()
+	for _, params := range []*Params{SHA2_10_256, SHA2_20_4_256, SHA2_60_12_192} {
+		n := params.n
+		idx := int(params.indexBytes)
+		// Fill the fields with distinct bytes: index 0x01, prvSeed 0x02,
+		// prfSeed 0x03, pubSeed 0x04 and root 0x05
+		prv := make(PrivateXMSS, params.prvBytes)
+		copy(prv, bytes.Repeat([]byte{1}, idx))
+		for i, b := range []byte{2, 3, 4, 5} {
+			copy(prv[idx+i*n:], bytes.Repeat([]byte{b}, n))
+		}
+		expected := append(bytes.Repeat([]byte{1}, idx), bytes.Repeat([]byte{2}, n)...)
+		expected = append(expected, bytes.Repeat([]byte{3}, n)...)
+		expected = append(expected, bytes.Repeat([]byte{5}, n)...)
+		expected = append(expected, bytes.Repeat([]byte{4}, n)...)
+
+		ref, err := ExportPrivateKey(params, prv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(ref, expected) {
+			t.Errorf("%s: unexpected reference layout %x", params.Name(), ref)
+		}
+		back, err := ImportPrivateKey(params, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(back, prv) {
+			t.Errorf("%s: private key did not survive the round trip", params.Name())
+		}
+		if _, err := ImportPrivateKey(params, ref[1:]); err == nil {
+			t.Errorf("%s: truncated private key was imported", params.Name())
+		}
+	}
+}
+
+func TestDeterministicKeyGeneration(t *testing.T) {
+	t.Parallel()
+	params := SHA2_20_4_256
+	seeds := make([]byte, 3*params.n)
+	rand.Read(seeds)
+	n := params.n
+
+	prv1, err := NewKeyFromSeeds(params, seeds[:n], seeds[n:2*n], seeds[2*n:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	prv2, err := GenerateKey(params, bytes.NewReader(seeds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(prv1.Key(), prv2.Key()) {
+		t.Error("Keys generated from the same seeds do not match")
+	}
+	expected := append(make([]byte, params.indexBytes), seeds...)
+	if !bytes.Equal(prv1.Key()[:len(expected)], expected) {
+		t.Error("Private key does not contain the index and the seeds")
+	}
+
+	if _, err := GenerateKey(params, bytes.NewReader(seeds[1:])); err == nil {
+		t.Error("Key generation did not fail on a short entropy source")
+	}
+	if _, err := NewKeyFromSeeds(params, seeds[:n], seeds[n:2*n], seeds[2*n+1:]); err == nil {
+		t.Error("Key generation did not fail on a short seed")
+	}
+}
+
+func TestKeyFromSeedsTestData(t *testing.T) {
+	t.Parallel()
+	params := SHA2_10_256
+	n := params.n
+	key, err := ioutil.ReadFile(dataDir + "/SHA2_10_256.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ioutil.ReadFile(dataDir + "/SHA2_10_256.pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeds := key[params.indexBytes:]
+	prv, err := NewKeyFromSeeds(params, seeds[:n], seeds[n:2*n], seeds[2*n:3*n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(prv.PublicKey().Bytes(), pub) {
+		t.Error("Key recovered from the seeds does not match the stored public key")
+	}
+}
+
+func TestKeyExhaustion(t *testing.T) {
+	t.Parallel()
+	params, err := NewParams(SHA2, 32, 16, 4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prv, err := GenerateKey(params, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls []uint64
+	prv.SetLowWaterMark(2, func(remaining uint64) {
+		// The key is unlocked, so rotation code can use it
+		if prv.Remaining() != remaining {
+			t.Errorf("Callback with %d remaining, but the key has %d", remaining, prv.Remaining())
+		}
+		calls = append(calls, remaining)
+	})
+
+	msg := []byte("message")
+	for i := uint64(0); i < params.MaxSignatures(); i++ {
+		if prv.Index() != i || prv.Remaining() != params.MaxSignatures()-i {
+			t.Fatalf("Unexpected index %d and remaining %d before signature %d", prv.Index(), prv.Remaining(), i)
+		}
+		if _, err := prv.SignMessage(msg); err != nil {
+			t.Fatalf("Signature %d failed: %v", i, err)
+		}
+	}
+	if prv.Remaining() != 0 {
+		t.Errorf("Expected no remaining signatures, got %d", prv.Remaining())
+	}
+	if _, err := prv.SignMessage(msg); err != ErrKeyExhausted {
+		t.Errorf("Expected %v, got %v", ErrKeyExhausted, err)
+	}
+	if prv.Key().Sign(params, msg) != nil {
+		t.Error("Sign did not refuse an exhausted key")
+	}
+	if prv.Index() != params.MaxSignatures() {
+		t.Errorf("Index moved past the end to %d", prv.Index())
+	}
+	if len(calls) != 3 || calls[0] != 2 || calls[1] != 1 || calls[2] != 0 {
+		t.Errorf("Unexpected low-water mark calls %v", calls)
+	}
+}
+
+// TestKeyExhaustionFullIndex uses an XMSS^MT key whose index of h/8 bytes
+// has no room for 2^h
+func TestKeyExhaustionFullIndex(t *testing.T) {
+	t.Parallel()
+	params, err := NewParams(SHA2, 32, 16, 8, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.MaxSignatures() != 255 {
+		t.Fatalf("Key with a 1-byte index allows %d signatures", params.MaxSignatures())
+	}
+	gen, err := GenerateKey(params, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := gen.Key()
+	raw.setIndex(params, params.MaxSignatures()-1)
+	prv, err := NewPrivateKey(params, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("last signature")
+	sig, err := prv.SignDetached(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyDetached(prv.PublicKey(), msg, sig); err != nil {
+		t.Fatal(err)
+	}
+	if prv.Index() != params.MaxSignatures() || prv.Remaining() != 0 {
+		t.Errorf("Exhausted key at index %d with %d remaining", prv.Index(), prv.Remaining())
+	}
+	if prv.Key()[0] != 0xff {
+		t.Errorf("Exhausted key stores index %d", prv.Key()[0])
+	}
+	if _, err := prv.SignDetached(msg); err != ErrKeyExhausted {
+		t.Errorf("Expected %v, got %v", ErrKeyExhausted, err)
+	}
+	if prv.Key().Sign(params, msg) != nil {
+		t.Error("Sign did not refuse an exhausted key")
+	}
+}
+
+func TestDetached(t *testing.T) {
+	t.Parallel()
+	params := SHA2_20_4_256
+	prv, err := GenerateKey(params, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := prv.PublicKey()
+	msg := make([]byte, 100)
+	rand.Read(msg)
+
+	sig, err := prv.SignDetached(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sig) != params.SignBytes() {
+		t.Fatalf("Detached signature of %d bytes, expected %d", len(sig), params.SignBytes())
+	}
+	if err := VerifyDetached(pub, msg, sig); err != nil {
+		t.Errorf("Verification failed: %v", err)
+	}
+
+	// A detached signature is the attached one without the message
+	attached, err := prv.SignMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyDetached(pub, msg, attached[:params.SignBytes()]); err != nil {
+		t.Errorf("Verification of the attached signature failed: %v", err)
+	}
+
+	msg[0] ^= 1
+	if err := VerifyDetached(pub, msg, sig); err != ErrInvalidSignature {
+		t.Errorf("Expected %v for a modified message, got %v", ErrInvalidSignature, err)
+	}
+	if err := VerifyDetached(pub, msg, sig[1:]); err != ErrInvalidSignatureLength {
+		t.Errorf("Expected %v for a short signature, got %v", ErrInvalidSignatureLength, err)
+	}
+	if err := VerifyDetached(pub, msg, append(sig, 0)); err != ErrInvalidSignatureLength {
+		t.Errorf("Expected %v for a long signature, got %v", ErrInvalidSignatureLength, err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+	params := SHA2_20_4_256
+	prv, err := GenerateKey(params, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := prv.PublicKey()
+	msg := []byte("attached message")
+	signed, err := prv.SignMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := Open(nil, signed, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, msg) {
+		t.Errorf("Open returned %q, expected %q", opened, msg)
+	}
+
+	prefix := []byte("prefix: ")
+	out := make([]byte, len(prefix), len(prefix)+len(msg))
+	copy(out, prefix)
+	opened, err = Open(out, signed, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, append(prefix, msg...)) || &opened[0] != &out[0] {
+		t.Errorf("Open did not append to the given slice, got %q", opened)
+	}
+
+	signed[len(signed)-1] ^= 1
+	if opened, err := Open(prefix, signed, pub); err != ErrInvalidSignature || !bytes.Equal(opened, prefix) {
+		t.Errorf("Expected %v and an unchanged slice for a modified message, got %v and %q", ErrInvalidSignature, err, opened)
+	}
+	if _, err := Open(nil, signed[:params.SignBytes()-1], pub); err != ErrInvalidSignatureLength {
+		t.Errorf("Expected %v for a short signed message, got %v", ErrInvalidSignatureLength, err)
+	}
+}
+
+// failingReader returns err after the data has been read
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestStreaming(t *testing.T) {
+	t.Parallel()
+	params := SHA2_20_4_256
+	prv, err := GenerateKey(params, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := prv.PublicKey()
+	msg := make([]byte, 1<<20+17)
+	rand.Read(msg)
+
+	sig, err := prv.SignReader(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyDetached(pub, msg, sig); err != nil {
+		t.Errorf("Streamed signature does not verify: %v", err)
+	}
+	sig, err = prv.SignDetached(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyReader(pub, bytes.NewReader(msg), sig); err != nil {
+		t.Errorf("Streamed verification failed: %v", err)
+	}
+	if err := VerifyReader(pub, bytes.NewReader(msg[1:]), sig); err != ErrInvalidSignature {
+		t.Errorf("Expected %v for a modified message, got %v", ErrInvalidSignature, err)
+	}
+
+	readErr := errors.New("read failed")
+	idx := prv.Index()
+	if _, err := prv.SignReader(&failingReader{data: msg[:100], err: readErr}); err != readErr {
+		t.Errorf("Expected %v, got %v", readErr, err)
+	}
+	if prv.Index() != idx+1 {
+		t.Error("Failed read did not skip its one-time key")
+	}
+	if err := VerifyReader(pub, &failingReader{data: msg, err: readErr}, sig); err != readErr {
+		t.Errorf("Expected %v, got %v", readErr, err)
+	}
+}
+
+func TestStalledReader(t *testing.T) {
+	t.Parallel()
+	prv, err := GenerateKey(SHA2_10_256, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, pw := io.Pipe()
+	done := make(chan error)
+	var sig []byte
+	go func() {
+		var err error
+		sig, err = prv.SignReader(pr)
+		done <- err
+	}()
+
+	// The key is not locked while the reader stalls
+	pw.Write([]byte("stalled "))
+	if idx := prv.Index(); idx != 1 {
+		t.Errorf("Index is %d while the message is read, expected 1", idx)
+	}
+	other, err := prv.SignDetached([]byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.Write([]byte("message"))
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyDetached(prv.PublicKey(), []byte("stalled message"), sig); err != nil {
+		t.Error(err)
+	}
+	if err := VerifyDetached(prv.PublicKey(), []byte("other"), other); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	t.Parallel()
+	params, err := NewParams(SHA2, 32, 16, 5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prv, err := GenerateKey(params, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signer crypto.Signer = prv
+	pub, ok := signer.Public().(*PublicKey)
+	if !ok || !pub.Equal(prv.PublicKey()) {
+		t.Fatalf("Public returned %T", signer.Public())
+	}
+	msg := []byte("crypto.Signer")
+
+	sig, err := signer.Sign(rand.Reader, msg, crypto.Hash(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyDetached(pub, msg, sig); err != nil {
+		t.Errorf("Verification of the raw message failed: %v", err)
+	}
+
+	digest := sha256.Sum256(msg)
+	if sig, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyDetached(pub, digest[:], sig); err != nil {
+		t.Errorf("Verification of the digest failed: %v", err)
+	}
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA512); err == nil {
+		t.Error("Sign accepted a digest of the wrong length")
+	}
+	if prv.Index() != 2 {
+		t.Errorf("Signing moved the index to %d, expected 2", prv.Index())
+	}
+
+	other, err := GenerateKey(params, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub.Equal(other.PublicKey()) || pub.Equal(pub.pub) {
+		t.Error("Equal matched another key")
+	}
+}
+
+func TestRootMismatch(t *testing.T) {
+	t.Parallel()
+	params, err := NewParams(SHA2, 32, 16, 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := GenerateKey(params, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := params.WithKeyDerivation(KeyDerivationSP800208)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("root mismatch")
+
+	// The key does not sign under the other key derivation, neither with
+	// traversal state nor without
+	raw := make(PrivateXMSS, len(gen.prv))
+	copy(raw, gen.prv)
+	prv, err := NewPrivateKey(other, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prv.SignDetached(msg); err != ErrRootMismatch {
+		t.Errorf("Signing with traversal state returned %v", err)
+	}
+	copy(raw, gen.prv)
+	signature := make([]byte, other.SignBytes())
+	if err := raw.signReader(other, signature, bytes.NewReader(msg), nil, nil); err != ErrRootMismatch {
+		t.Errorf("Signing without traversal state returned %v", err)
+	}
+	if !bytes.Equal(signature, make([]byte, len(signature))) {
+		t.Error("Signature under another root was released")
+	}
+
+	// Under its own key derivation it signs
+	sig, err := gen.SignDetached(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyDetached(gen.PublicKey(), msg, sig); err != nil {
+		t.Error(err)
+	}
+}
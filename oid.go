@@ -0,0 +1,78 @@
+package xmss
+
+import "fmt"
+
+// xmssParams lists the XMSS parameter sets in OID order
+var xmssParams = []*Params{
+	SHA2_10_256, SHA2_16_256, SHA2_20_256,
+	SHA2_10_512, SHA2_16_512, SHA2_20_512,
+	SHAKE_10_256, SHAKE_16_256, SHAKE_20_256,
+	SHAKE_10_512, SHAKE_16_512, SHAKE_20_512,
+	SHA2_10_192, SHA2_16_192, SHA2_20_192,
+	SHAKE256_10_256, SHAKE256_16_256, SHAKE256_20_256,
+	SHAKE256_10_192, SHAKE256_16_192, SHAKE256_20_192,
+}
+
+// xmssmtParams lists the XMSS^MT parameter sets in OID order
+var xmssmtParams = []*Params{
+	SHA2_20_2_256, SHA2_20_4_256, SHA2_40_2_256, SHA2_40_4_256,
+	SHA2_40_8_256, SHA2_60_3_256, SHA2_60_6_256, SHA2_60_12_256,
+	SHA2_20_2_512, SHA2_20_4_512, SHA2_40_2_512, SHA2_40_4_512,
+	SHA2_40_8_512, SHA2_60_3_512, SHA2_60_6_512, SHA2_60_12_512,
+	SHAKE_20_2_256, SHAKE_20_4_256, SHAKE_40_2_256, SHAKE_40_4_256,
+	SHAKE_40_8_256, SHAKE_60_3_256, SHAKE_60_6_256, SHAKE_60_12_256,
+	SHAKE_20_2_512, SHAKE_20_4_512, SHAKE_40_2_512, SHAKE_40_4_512,
+	SHAKE_40_8_512, SHAKE_60_3_512, SHAKE_60_6_512, SHAKE_60_12_512,
+	SHA2_20_2_192, SHA2_20_4_192, SHA2_40_2_192, SHA2_40_4_192,
+	SHA2_40_8_192, SHA2_60_3_192, SHA2_60_6_192, SHA2_60_12_192,
+	SHAKE256_20_2_256, SHAKE256_20_4_256, SHAKE256_40_2_256, SHAKE256_40_4_256,
+	SHAKE256_40_8_256, SHAKE256_60_3_256, SHAKE256_60_6_256, SHAKE256_60_12_256,
+	SHAKE256_20_2_192, SHAKE256_20_4_192, SHAKE256_40_2_192, SHAKE256_40_4_192,
+	SHAKE256_40_8_192, SHAKE256_60_3_192, SHAKE256_60_6_192, SHAKE256_60_12_192,
+}
+
+// OID returns the identifier RFC 8391 or NIST SP 800-208 assigns to the
+// parameter set, or 0 for custom parameters. XMSS and XMSS^MT use separate
+// OID spaces, see ParamsByOID and ParamsMTByOID.
+func (params *Params) OID() uint32 {
+	return params.oid
+}
+
+// Name returns the name of the parameter set as used by RFC 8391 and
+// NIST SP 800-208, e.g. XMSS-SHA2_10_256 or XMSSMT-SHA2_20/2_256.
+func (params *Params) Name() string {
+	return params.name
+}
+
+// ParamsByOID returns the XMSS parameter set with the given OID
+func ParamsByOID(oid uint32) (*Params, error) {
+	for _, params := range xmssParams {
+		if params.oid == oid {
+			return params, nil
+		}
+	}
+	return nil, fmt.Errorf("xmss: unknown XMSS OID 0x%08x", oid)
+}
+
+// ParamsMTByOID returns the XMSS^MT parameter set with the given OID
+func ParamsMTByOID(oid uint32) (*Params, error) {
+	for _, params := range xmssmtParams {
+		if params.oid == oid {
+			return params, nil
+		}
+	}
+	return nil, fmt.Errorf("xmss: unknown XMSS^MT OID 0x%08x", oid)
+}
+
+// ParamsByName returns the XMSS or XMSS^MT parameter set with the given name,
+// e.g. XMSS-SHA2_10_256 or XMSSMT-SHA2_20/2_256
+func ParamsByName(name string) (*Params, error) {
+	for _, list := range [][]*Params{xmssParams, xmssmtParams} {
+		for _, params := range list {
+			if params.name == name {
+				return params, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("xmss: unknown parameter set %q", name)
+}
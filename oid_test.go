@@ -0,0 +1,64 @@
+package xmss
+
+import "testing"
+
+func TestOID(t *testing.T) {
+	t.Parallel()
+	for i, params := range xmssParams {
+		if params.OID() != uint32(i+1) {
+			t.Errorf("%s has OID 0x%08x, expected 0x%08x", params.Name(), params.OID(), i+1)
+		}
+		if p, err := ParamsByOID(params.OID()); err != nil || p != params {
+			t.Errorf("ParamsByOID(0x%08x) did not return %s", params.OID(), params.Name())
+		}
+		if p, err := ParamsByName(params.Name()); err != nil || p != params {
+			t.Errorf("ParamsByName(%q) did not return the expected parameter set", params.Name())
+		}
+	}
+	for i, params := range xmssmtParams {
+		if params.OID() != uint32(i+1) {
+			t.Errorf("%s has OID 0x%08x, expected 0x%08x", params.Name(), params.OID(), i+1)
+		}
+		if p, err := ParamsMTByOID(params.OID()); err != nil || p != params {
+			t.Errorf("ParamsMTByOID(0x%08x) did not return %s", params.OID(), params.Name())
+		}
+		if p, err := ParamsByName(params.Name()); err != nil || p != params {
+			t.Errorf("ParamsByName(%q) did not return the expected parameter set", params.Name())
+		}
+	}
+
+	known := map[string]*Params{
+		"XMSS-SHA2_10_256":          SHA2_10_256,
+		"XMSS-SHAKE_20_512":         SHAKE_20_512,
+		"XMSS-SHA2_10_192":          SHA2_10_192,
+		"XMSS-SHAKE256_16_256":      SHAKE256_16_256,
+		"XMSSMT-SHA2_20/2_256":      SHA2_20_2_256,
+		"XMSSMT-SHAKE_60/12_512":    SHAKE_60_12_512,
+		"XMSSMT-SHAKE256_60/12_192": SHAKE256_60_12_192,
+	}
+	for name, params := range known {
+		if params.Name() != name {
+			t.Errorf("Expected name %q, got %q", name, params.Name())
+		}
+	}
+	if SHA2_10_192.OID() != 0x0d || SHAKE256_60_12_192.OID() != 0x38 {
+		t.Error("SP 800-208 parameter sets have wrong OIDs")
+	}
+
+	if _, err := ParamsByOID(0); err == nil {
+		t.Error("ParamsByOID(0) did not fail")
+	}
+	if _, err := ParamsMTByOID(0x39); err == nil {
+		t.Error("ParamsMTByOID(0x39) did not fail")
+	}
+	if _, err := ParamsByName("XMSS-SHA2_12_256"); err == nil {
+		t.Error("ParamsByName did not fail for an unknown name")
+	}
+
+	if params, _ := NewParams(SHA2, 32, 16, 10, 1); params != SHA2_10_256 {
+		t.Error("NewParams did not return the standard parameter set")
+	}
+	if params, _ := NewParams(SHA2, 32, 4, 10, 1); params.OID() != 0 || params.Name() != "XMSS-SHA2_10_256_w4" {
+		t.Errorf("Unexpected identity %q, 0x%08x for custom parameters", params.Name(), params.OID())
+	}
+}
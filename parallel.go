@@ -0,0 +1,88 @@
+package xmss
+
+import (
+	"runtime"
+	"sync"
+)
+
+// subtreesPerWorker is the number of subtrees each goroutine computes on
+// average, so that goroutines that finish early pick up more work
+const subtreesPerWorker = 4
+
+// treeNodesParallel is treeNodes with the leaves spread over workers
+// goroutines. The tree is split into 2^s subtrees that are computed
+// independently, then their roots are hashed together on the calling
+// goroutine with the same addresses treeNodes uses. The root and the nodes
+// passed to visit are identical to those of treeNodes, only the order of the
+// calls differs. visit is never called concurrently. workers < 1 uses
+// runtime.GOMAXPROCS(0) goroutines. Cancellation is handled like treeNodes.
+func treeNodesParallel(hs *hasher, root []byte, subtreeA address, workers int, visit func(height, index uint32, node []byte)) error {
+	params := hs.params
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	h := params.treeHeight
+	if workers == 1 || h == 0 {
+		return treeNodes(hs, root, subtreeA, visit)
+	}
+	n := uint32(params.n)
+
+	// Split the tree into 2^s subtrees of height h - s
+	s := uint32(0)
+	for s < h && 1<<s < subtreesPerWorker*workers {
+		s++
+	}
+	sub := h - s
+	roots := make([]byte, (1<<s)*n)
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+	lockedVisit := func(height, index uint32, node []byte) {
+		mu.Lock()
+		visit(height, index, node)
+		mu.Unlock()
+	}
+	jobs := make(chan uint32)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(hs *hasher) {
+			defer wg.Done()
+			for j := range jobs {
+				if err := rangeNodes(hs, roots[j*n:(j+1)*n], subtreeA, j<<sub, sub, lockedVisit); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}(hs.clone())
+	}
+	for j := uint32(0); j < 1<<s; j++ {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+
+	// Merge the subtree roots layer by layer. The parent of the nodes 2i and
+	// 2i + 1 replaces node i, which has already been merged.
+	var nodeA address
+	nodeA.copySubtreeAddr(subtreeA)
+	nodeA.setType(xmssAddrTypeHASHTREE)
+	for height := sub; height < h; height++ {
+		for i := uint32(0); i < 1<<(h-height-1); i++ {
+			nodeA.setTreeHeight(height)
+			nodeA.setTreeIndex(i)
+			hs.hashH(roots[i*n:(i+1)*n], roots[2*i*n:(2*i+2)*n], &nodeA)
+			visit(height+1, i, roots[i*n:(i+1)*n])
+		}
+	}
+	copy(root, roots[:n])
+	return nil
+}
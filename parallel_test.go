@@ -0,0 +1,82 @@
+package xmss
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestTreeNodesParallel(t *testing.T) {
+	t.Parallel()
+	params, err := NewParams(SHA2, 32, 16, 5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := make([]byte, params.n)
+	collect := func(workers int) (map[string][]byte, []byte) {
+		nodes := make(map[string][]byte)
+		root := make([]byte, params.n)
+		var a address
+		treeNodesParallel(newHasher(params, seed, seed), root, a, workers, func(height, index uint32, node []byte) {
+			key := fmt.Sprintf("%d/%d", height, index)
+			if _, ok := nodes[key]; ok {
+				t.Errorf("Node %s visited twice", key)
+			}
+			nodes[key] = append([]byte(nil), node...)
+		})
+		return nodes, root
+	}
+
+	want, wantRoot := collect(1)
+	if len(want) != 1<<6-1 {
+		t.Fatalf("Visited %d nodes", len(want))
+	}
+	for _, workers := range []int{2, 3, 8, 64} {
+		got, root := collect(workers)
+		if !bytes.Equal(root, wantRoot) {
+			t.Errorf("Root computed by %d workers differs", workers)
+		}
+		if len(got) != len(want) {
+			t.Errorf("%d workers visited %d nodes, expected %d", workers, len(got), len(want))
+		}
+		for key, node := range want {
+			if !bytes.Equal(got[key], node) {
+				t.Errorf("Node %s computed by %d workers differs", key, workers)
+			}
+		}
+	}
+}
+
+func TestGenerateKeyParallel(t *testing.T) {
+	t.Parallel()
+	for _, params := range []*Params{SHA2_10_256, SHA2_20_4_256} {
+		seeds := bytes.Repeat([]byte{7}, 3*params.n)
+		want, err := GenerateKey(params, bytes.NewReader(seeds))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := GenerateKeyParallel(params, bytes.NewReader(seeds), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Key(), want.Key()) {
+			t.Errorf("%s: parallel key generation returned a different key", params.Name())
+		}
+
+		// The traversal state set up by the parallel pass signs identically
+		m := []byte("parallel test message")
+		for i := 0; i < 3; i++ {
+			wantSig, err := want.SignMessage(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotSig, err := got.SignMessage(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(gotSig, wantSig) {
+				t.Errorf("%s: signature %d differs", params.Name(), i)
+			}
+		}
+	}
+}
@@ -1,10 +1,72 @@
 package xmss
 
-import "math"
+import (
+	"fmt"
+	"math/bits"
+)
+
+// HashFunc identifies the hash function family a parameter set is built on
+type HashFunc uint8
+
+const (
+	// SHA2 is SHA-256 for n = 24 (truncated) and n = 32, SHA-512 for n = 64
+	SHA2 HashFunc = iota
+	// SHAKE128 with n bytes of output
+	SHAKE128
+	// SHAKE256 with n bytes of output
+	SHAKE256
+)
+
+func (f HashFunc) String() string {
+	switch f {
+	case SHA2:
+		return "SHA2"
+	case SHAKE128:
+		return "SHAKE128"
+	case SHAKE256:
+		return "SHAKE256"
+	}
+	return fmt.Sprintf("HashFunc(%d)", uint8(f))
+}
+
+// KeyDerivation selects how the WOTS+ private keys are derived from the
+// secret seed SK_SEED. It changes every key pair and therefore the root, but
+// not the format of keys and signatures.
+type KeyDerivation int
+
+const (
+	// KeyDerivationLegacy derives a seed per WOTS+ key pair as
+	// PRF(SK_SEED, ADRS) and expands it into the chains with
+	// PRF(seed, toByte(i, 32)), like the reference implementation before it
+	// adopted NIST SP 800-208. It is the default of the RFC 8391 parameter
+	// sets, which keeps existing keys of this package working.
+	KeyDerivationLegacy KeyDerivation = iota
+	// KeyDerivationSP800208 derives chain i of every WOTS+ key pair as
+	// PRF_keygen(SK_SEED, PUB_SEED || ADRS), where ADRS has chain address i,
+	// as NIST SP 800-208, Section 5.1 requires and the current reference
+	// implementation does for every parameter set. It is the default of the
+	// parameter sets that only SP 800-208 defines.
+	KeyDerivationSP800208
+)
+
+// String returns the name of the key derivation
+func (kd KeyDerivation) String() string {
+	switch kd {
+	case KeyDerivationLegacy:
+		return "legacy"
+	case KeyDerivationSP800208:
+		return "SP 800-208"
+	}
+	return fmt.Sprintf("KeyDerivation(%d)", int(kd))
+}
 
 // Params is a struct for parameters
 type Params struct {
+	oid         uint32
+	name        string
+	hash        HashFunc
 	n           int
+	paddingLen  int
 	w           int
 	log2w       uint
 	len1        uint32
@@ -18,6 +80,7 @@ type Params struct {
 	prvBytes    uint32
 	pubBytes    uint32
 	signBytes   uint32
+	keygen      KeyDerivation
 }
 
 // SignBytes the length of the signature based on a given parameter set
@@ -25,20 +88,193 @@ func (params *Params) SignBytes() int {
 	return int(params.signBytes)
 }
 
-func initParams(n, w, h int) *Params {
-	log2w := uint(math.Log2(float64(w)))
-	len1 := uint32(math.Ceil(float64(8 * n / int(log2w))))
-	len2 := uint32(math.Floor(math.Log2(float64(len1*uint32(w-1)))/math.Log2(float64(w)))) + 1 // len2 = 3
+// Hash returns the hash function family of the parameter set
+func (params *Params) Hash() HashFunc {
+	return params.hash
+}
+
+// N returns the length in bytes of the hash outputs, seeds and tree nodes
+func (params *Params) N() int {
+	return params.n
+}
+
+// W returns the Winternitz parameter
+func (params *Params) W() int {
+	return params.w
+}
+
+// Len returns the number of n-byte elements in a WOTS+ key or signature
+func (params *Params) Len() int {
+	return int(params.wlen)
+}
+
+// Height returns the total height h of the (hyper-)tree
+func (params *Params) Height() int {
+	return params.fullHeight
+}
+
+// Layers returns the number of tree layers d, which is 1 for XMSS
+func (params *Params) Layers() int {
+	return params.d
+}
+
+// TreeHeight returns the height h/d of a single tree layer
+func (params *Params) TreeHeight() int {
+	return int(params.treeHeight)
+}
+
+// IndexBytes returns the length of the signature index in keys and signatures
+func (params *Params) IndexBytes() int {
+	return int(params.indexBytes)
+}
+
+// PublicKeyBytes returns the length of a public key without an OID
+func (params *Params) PublicKeyBytes() int {
+	return int(params.pubBytes)
+}
+
+// PrivateKeyBytes returns the length of a private key without an OID
+func (params *Params) PrivateKeyBytes() int {
+	return int(params.prvBytes)
+}
+
+// KeyDerivation returns how the WOTS+ private keys are derived
+func (params *Params) KeyDerivation() KeyDerivation {
+	return params.keygen
+}
+
+// WithKeyDerivation returns a copy of the parameter set that derives the
+// WOTS+ private keys with kd, e.g. SHA2_10_256.WithKeyDerivation(
+// KeyDerivationSP800208) for keys generated by the current reference
+// implementation. The copy has the same name and OID.
+func (params *Params) WithKeyDerivation(kd KeyDerivation) (*Params, error) {
+	if kd != KeyDerivationLegacy && kd != KeyDerivationSP800208 {
+		return nil, fmt.Errorf("xmss: unknown key derivation %v", kd)
+	}
+	c := *params
+	c.keygen = kd
+	return &c, nil
+}
+
+// MaxSignatures returns the number of signatures a key can create, 2^h. If
+// the index of h/8 bytes cannot hold 2^h, which happens for XMSS^MT when h is
+// a multiple of 8, it is 2^h - 1: an index of all ones marks an exhausted key,
+// as in the reference implementation.
+func (params *Params) MaxSignatures() uint64 {
+	max := uint64(1) << uint(params.fullHeight)
+	if 8*params.indexBytes == uint32(params.fullHeight) {
+		max--
+	}
+	return max
+}
+
+// String summarizes the parameter set
+func (params *Params) String() string {
+	return fmt.Sprintf("%s (OID 0x%08x): n = %d, w = %d, len = %d, h = %d, d = %d, %d signatures of %d bytes",
+		params.name, params.oid, params.n, params.w, params.wlen, params.fullHeight, params.d,
+		params.MaxSignatures(), params.signBytes)
+}
+
+// NewParams returns a custom parameter set using the hash function hash with
+// n-byte outputs, Winternitz parameter w and a tree of total height h split
+// into d layers. With d = 1 the parameters describe XMSS, otherwise XMSS^MT.
+// Supported values are n = 24, 32 or 64 (SHAKE128 only with n = 32),
+// w = 4, 16 or 256, a subtree height h/d of at most 31 and h of at most 63.
+func NewParams(hash HashFunc, n, w, h, d int) (*Params, error) {
+	switch hash {
+	case SHA2, SHAKE256:
+		if n != 24 && n != 32 && n != 64 {
+			return nil, fmt.Errorf("xmss: unsupported n = %d for %v", n, hash)
+		}
+	case SHAKE128:
+		if n != 32 {
+			return nil, fmt.Errorf("xmss: unsupported n = %d for %v", n, hash)
+		}
+	default:
+		return nil, fmt.Errorf("xmss: unknown hash function %v", hash)
+	}
+	if w != 4 && w != 16 && w != 256 {
+		return nil, fmt.Errorf("xmss: unsupported Winternitz parameter w = %d", w)
+	}
+	if h < 1 || h > 63 {
+		return nil, fmt.Errorf("xmss: unsupported tree height h = %d", h)
+	}
+	if d < 1 || h%d != 0 {
+		return nil, fmt.Errorf("xmss: tree height h = %d is not divisible into d = %d layers", h, d)
+	}
+	if h/d > 31 {
+		return nil, fmt.Errorf("xmss: unsupported subtree height h/d = %d", h/d)
+	}
+	params := initParams(0, hash, n, w, h, d)
+	// Hand out the standard set if the caller asked for one, so that it
+	// carries its OID
+	if std, err := ParamsByName(params.name); err == nil {
+		return std, nil
+	}
+	return params, nil
+}
+
+// paramsName builds the RFC 8391 / SP 800-208 name of a parameter set, e.g.
+// XMSS-SHA2_10_256 or XMSSMT-SHAKE256_20/4_192. Non-standard Winternitz
+// parameters are appended as _w4 or _w256.
+func paramsName(hash HashFunc, n, w, h, d int) string {
+	family := "SHA2"
+	switch {
+	case hash == SHAKE128 || (hash == SHAKE256 && n == 64):
+		// RFC 8391 calls both the SHAKE128 n = 32 and SHAKE256 n = 64 sets "SHAKE"
+		family = "SHAKE"
+	case hash == SHAKE256:
+		family = "SHAKE256"
+	}
+	name := fmt.Sprintf("XMSS-%s_%d_%d", family, h, 8*n)
+	if d > 1 {
+		name = fmt.Sprintf("XMSSMT-%s_%d/%d_%d", family, h, d, 8*n)
+	}
+	if w != 16 {
+		name += fmt.Sprintf("_w%d", w)
+	}
+	return name
+}
+
+// initParams computes the derived sizes for a tree of total height h split
+// into d layers. With d = 1 this is plain XMSS, otherwise XMSS^MT. The oid is
+// the identifier assigned by RFC 8391 or NIST SP 800-208, the XMSS and XMSS^MT
+// sets use separate OID spaces.
+func initParams(oid uint32, hash HashFunc, n, w, h, d int) *Params {
+	// w is a power of two, so all of the logarithms are exact
+	log2w := uint(bits.TrailingZeros(uint(w)))
+	len1 := uint32((8*n + int(log2w) - 1) / int(log2w))
+	len2 := uint32(bits.Len32(len1*uint32(w-1))-1)/uint32(log2w) + 1
 	wlen := len1 + len2
+	// The domain separation prefix toByte(x, n) is shortened to 4 bytes for
+	// the 192-bit sets (NIST SP 800-208, Section 5)
+	paddingLen := n
+	if n == 24 {
+		paddingLen = 4
+	}
+	// RFC 8391 predates PRF_keygen. The sets that only SP 800-208 defines
+	// have no keys that were generated without it.
+	keygen := KeyDerivationLegacy
+	if n == 24 || (hash == SHAKE256 && n == 32) {
+		keygen = KeyDerivationSP800208
+	}
 	wotsSignLen := wlen * uint32(n)
-	d := 1
 	treeHeight := uint32(h / d)
+	// XMSS uses a fixed 32-bit index, XMSS^MT uses ceil(h / 8) bytes
+	// (RFC 8391, Section 4.2.3)
 	indexBytes := uint32(4)
+	if d > 1 {
+		indexBytes = uint32((h + 7) / 8)
+	}
 	prvBytes := indexBytes + uint32(4*n)
 	pubBytes := uint32(2 * n)
 	signBytes := uint32(indexBytes + uint32(n) + uint32(d)*wotsSignLen + uint32(h*n))
 	return &Params{
+		oid:         oid,
+		name:        paramsName(hash, n, w, h, d),
+		hash:        hash,
 		n:           n,
+		paddingLen:  paddingLen,
 		w:           w,
 		log2w:       log2w,
 		len1:        len1,
@@ -46,20 +282,203 @@ func initParams(n, w, h int) *Params {
 		wlen:        wlen,
 		wotsSignLen: wotsSignLen,
 		fullHeight:  h,
-		d:           1,
+		d:           d,
 		treeHeight:  treeHeight,
 		indexBytes:  indexBytes,
 		prvBytes:    prvBytes,
 		pubBytes:    pubBytes,
 		signBytes:   signBytes,
+		keygen:      keygen,
 	}
 }
 
 var (
 	// SHA2_10_256 is parameter set using SHA-256 with n = 32, w = 16 and a Merkle Tree of height 10
-	SHA2_10_256 = initParams(32, 16, 10)
+	SHA2_10_256 = initParams(0x01, SHA2, 32, 16, 10, 1)
 	// SHA2_16_256 is parameter set using SHA-256 with n = 32, w = 16 and a Merkle Tree of height 16
-	SHA2_16_256 = initParams(32, 16, 16)
+	SHA2_16_256 = initParams(0x02, SHA2, 32, 16, 16, 1)
 	// SHA2_20_256 is parameter set using SHA-256 with n = 32, w = 16 and a Merkle Tree of height 20
-	SHA2_20_256 = initParams(32, 16, 20)
+	SHA2_20_256 = initParams(0x03, SHA2, 32, 16, 20, 1)
+)
+
+var (
+	// SHA2_10_512 is parameter set using SHA-512 with n = 64, w = 16 and a Merkle Tree of height 10
+	SHA2_10_512 = initParams(0x04, SHA2, 64, 16, 10, 1)
+	// SHA2_16_512 is parameter set using SHA-512 with n = 64, w = 16 and a Merkle Tree of height 16
+	SHA2_16_512 = initParams(0x05, SHA2, 64, 16, 16, 1)
+	// SHA2_20_512 is parameter set using SHA-512 with n = 64, w = 16 and a Merkle Tree of height 20
+	SHA2_20_512 = initParams(0x06, SHA2, 64, 16, 20, 1)
+)
+
+var (
+	// SHAKE_10_256 is parameter set using SHAKE128 with n = 32, w = 16 and a Merkle Tree of height 10
+	SHAKE_10_256 = initParams(0x07, SHAKE128, 32, 16, 10, 1)
+	// SHAKE_16_256 is parameter set using SHAKE128 with n = 32, w = 16 and a Merkle Tree of height 16
+	SHAKE_16_256 = initParams(0x08, SHAKE128, 32, 16, 16, 1)
+	// SHAKE_20_256 is parameter set using SHAKE128 with n = 32, w = 16 and a Merkle Tree of height 20
+	SHAKE_20_256 = initParams(0x09, SHAKE128, 32, 16, 20, 1)
+	// SHAKE_10_512 is parameter set using SHAKE256 with n = 64, w = 16 and a Merkle Tree of height 10
+	SHAKE_10_512 = initParams(0x0a, SHAKE256, 64, 16, 10, 1)
+	// SHAKE_16_512 is parameter set using SHAKE256 with n = 64, w = 16 and a Merkle Tree of height 16
+	SHAKE_16_512 = initParams(0x0b, SHAKE256, 64, 16, 16, 1)
+	// SHAKE_20_512 is parameter set using SHAKE256 with n = 64, w = 16 and a Merkle Tree of height 20
+	SHAKE_20_512 = initParams(0x0c, SHAKE256, 64, 16, 20, 1)
+)
+
+// XMSS^MT parameter sets (RFC 8391, Section 5.4). The name encodes the total
+// height and the number of layers, e.g. SHA2_20_4_256 is XMSSMT-SHA2_20/4_256.
+var (
+	// SHA2_20_2_256 is XMSS^MT parameter set using SHA-256 with n = 32, w = 16, total height 20 and 2 layers
+	SHA2_20_2_256 = initParams(0x01, SHA2, 32, 16, 20, 2)
+	// SHA2_20_4_256 is XMSS^MT parameter set using SHA-256 with n = 32, w = 16, total height 20 and 4 layers
+	SHA2_20_4_256 = initParams(0x02, SHA2, 32, 16, 20, 4)
+	// SHA2_40_2_256 is XMSS^MT parameter set using SHA-256 with n = 32, w = 16, total height 40 and 2 layers
+	SHA2_40_2_256 = initParams(0x03, SHA2, 32, 16, 40, 2)
+	// SHA2_40_4_256 is XMSS^MT parameter set using SHA-256 with n = 32, w = 16, total height 40 and 4 layers
+	SHA2_40_4_256 = initParams(0x04, SHA2, 32, 16, 40, 4)
+	// SHA2_40_8_256 is XMSS^MT parameter set using SHA-256 with n = 32, w = 16, total height 40 and 8 layers
+	SHA2_40_8_256 = initParams(0x05, SHA2, 32, 16, 40, 8)
+	// SHA2_60_3_256 is XMSS^MT parameter set using SHA-256 with n = 32, w = 16, total height 60 and 3 layers
+	SHA2_60_3_256 = initParams(0x06, SHA2, 32, 16, 60, 3)
+	// SHA2_60_6_256 is XMSS^MT parameter set using SHA-256 with n = 32, w = 16, total height 60 and 6 layers
+	SHA2_60_6_256 = initParams(0x07, SHA2, 32, 16, 60, 6)
+	// SHA2_60_12_256 is XMSS^MT parameter set using SHA-256 with n = 32, w = 16, total height 60 and 12 layers
+	SHA2_60_12_256 = initParams(0x08, SHA2, 32, 16, 60, 12)
+)
+
+var (
+	// SHA2_20_2_512 is XMSS^MT parameter set using SHA-512 with n = 64, w = 16, total height 20 and 2 layers
+	SHA2_20_2_512 = initParams(0x09, SHA2, 64, 16, 20, 2)
+	// SHA2_20_4_512 is XMSS^MT parameter set using SHA-512 with n = 64, w = 16, total height 20 and 4 layers
+	SHA2_20_4_512 = initParams(0x0a, SHA2, 64, 16, 20, 4)
+	// SHA2_40_2_512 is XMSS^MT parameter set using SHA-512 with n = 64, w = 16, total height 40 and 2 layers
+	SHA2_40_2_512 = initParams(0x0b, SHA2, 64, 16, 40, 2)
+	// SHA2_40_4_512 is XMSS^MT parameter set using SHA-512 with n = 64, w = 16, total height 40 and 4 layers
+	SHA2_40_4_512 = initParams(0x0c, SHA2, 64, 16, 40, 4)
+	// SHA2_40_8_512 is XMSS^MT parameter set using SHA-512 with n = 64, w = 16, total height 40 and 8 layers
+	SHA2_40_8_512 = initParams(0x0d, SHA2, 64, 16, 40, 8)
+	// SHA2_60_3_512 is XMSS^MT parameter set using SHA-512 with n = 64, w = 16, total height 60 and 3 layers
+	SHA2_60_3_512 = initParams(0x0e, SHA2, 64, 16, 60, 3)
+	// SHA2_60_6_512 is XMSS^MT parameter set using SHA-512 with n = 64, w = 16, total height 60 and 6 layers
+	SHA2_60_6_512 = initParams(0x0f, SHA2, 64, 16, 60, 6)
+	// SHA2_60_12_512 is XMSS^MT parameter set using SHA-512 with n = 64, w = 16, total height 60 and 12 layers
+	SHA2_60_12_512 = initParams(0x10, SHA2, 64, 16, 60, 12)
+)
+
+var (
+	// SHAKE_20_2_256 is XMSS^MT parameter set using SHAKE128 with n = 32, w = 16, total height 20 and 2 layers
+	SHAKE_20_2_256 = initParams(0x11, SHAKE128, 32, 16, 20, 2)
+	// SHAKE_20_4_256 is XMSS^MT parameter set using SHAKE128 with n = 32, w = 16, total height 20 and 4 layers
+	SHAKE_20_4_256 = initParams(0x12, SHAKE128, 32, 16, 20, 4)
+	// SHAKE_40_2_256 is XMSS^MT parameter set using SHAKE128 with n = 32, w = 16, total height 40 and 2 layers
+	SHAKE_40_2_256 = initParams(0x13, SHAKE128, 32, 16, 40, 2)
+	// SHAKE_40_4_256 is XMSS^MT parameter set using SHAKE128 with n = 32, w = 16, total height 40 and 4 layers
+	SHAKE_40_4_256 = initParams(0x14, SHAKE128, 32, 16, 40, 4)
+	// SHAKE_40_8_256 is XMSS^MT parameter set using SHAKE128 with n = 32, w = 16, total height 40 and 8 layers
+	SHAKE_40_8_256 = initParams(0x15, SHAKE128, 32, 16, 40, 8)
+	// SHAKE_60_3_256 is XMSS^MT parameter set using SHAKE128 with n = 32, w = 16, total height 60 and 3 layers
+	SHAKE_60_3_256 = initParams(0x16, SHAKE128, 32, 16, 60, 3)
+	// SHAKE_60_6_256 is XMSS^MT parameter set using SHAKE128 with n = 32, w = 16, total height 60 and 6 layers
+	SHAKE_60_6_256 = initParams(0x17, SHAKE128, 32, 16, 60, 6)
+	// SHAKE_60_12_256 is XMSS^MT parameter set using SHAKE128 with n = 32, w = 16, total height 60 and 12 layers
+	SHAKE_60_12_256 = initParams(0x18, SHAKE128, 32, 16, 60, 12)
+)
+
+var (
+	// SHAKE_20_2_512 is XMSS^MT parameter set using SHAKE256 with n = 64, w = 16, total height 20 and 2 layers
+	SHAKE_20_2_512 = initParams(0x19, SHAKE256, 64, 16, 20, 2)
+	// SHAKE_20_4_512 is XMSS^MT parameter set using SHAKE256 with n = 64, w = 16, total height 20 and 4 layers
+	SHAKE_20_4_512 = initParams(0x1a, SHAKE256, 64, 16, 20, 4)
+	// SHAKE_40_2_512 is XMSS^MT parameter set using SHAKE256 with n = 64, w = 16, total height 40 and 2 layers
+	SHAKE_40_2_512 = initParams(0x1b, SHAKE256, 64, 16, 40, 2)
+	// SHAKE_40_4_512 is XMSS^MT parameter set using SHAKE256 with n = 64, w = 16, total height 40 and 4 layers
+	SHAKE_40_4_512 = initParams(0x1c, SHAKE256, 64, 16, 40, 4)
+	// SHAKE_40_8_512 is XMSS^MT parameter set using SHAKE256 with n = 64, w = 16, total height 40 and 8 layers
+	SHAKE_40_8_512 = initParams(0x1d, SHAKE256, 64, 16, 40, 8)
+	// SHAKE_60_3_512 is XMSS^MT parameter set using SHAKE256 with n = 64, w = 16, total height 60 and 3 layers
+	SHAKE_60_3_512 = initParams(0x1e, SHAKE256, 64, 16, 60, 3)
+	// SHAKE_60_6_512 is XMSS^MT parameter set using SHAKE256 with n = 64, w = 16, total height 60 and 6 layers
+	SHAKE_60_6_512 = initParams(0x1f, SHAKE256, 64, 16, 60, 6)
+	// SHAKE_60_12_512 is XMSS^MT parameter set using SHAKE256 with n = 64, w = 16, total height 60 and 12 layers
+	SHAKE_60_12_512 = initParams(0x20, SHAKE256, 64, 16, 60, 12)
+)
+
+// NIST SP 800-208 parameter sets. SHA2_*_192 use SHA-256 truncated to 192 bits,
+// SHAKE256_* use SHAKE256 with n bytes of output.
+var (
+	// SHA2_10_192 is parameter set using SHA-256/192 with n = 24, w = 16 and a Merkle Tree of height 10
+	SHA2_10_192 = initParams(0x0d, SHA2, 24, 16, 10, 1)
+	// SHA2_16_192 is parameter set using SHA-256/192 with n = 24, w = 16 and a Merkle Tree of height 16
+	SHA2_16_192 = initParams(0x0e, SHA2, 24, 16, 16, 1)
+	// SHA2_20_192 is parameter set using SHA-256/192 with n = 24, w = 16 and a Merkle Tree of height 20
+	SHA2_20_192 = initParams(0x0f, SHA2, 24, 16, 20, 1)
+	// SHAKE256_10_256 is parameter set using SHAKE256/256 with n = 32, w = 16 and a Merkle Tree of height 10
+	SHAKE256_10_256 = initParams(0x10, SHAKE256, 32, 16, 10, 1)
+	// SHAKE256_16_256 is parameter set using SHAKE256/256 with n = 32, w = 16 and a Merkle Tree of height 16
+	SHAKE256_16_256 = initParams(0x11, SHAKE256, 32, 16, 16, 1)
+	// SHAKE256_20_256 is parameter set using SHAKE256/256 with n = 32, w = 16 and a Merkle Tree of height 20
+	SHAKE256_20_256 = initParams(0x12, SHAKE256, 32, 16, 20, 1)
+	// SHAKE256_10_192 is parameter set using SHAKE256/192 with n = 24, w = 16 and a Merkle Tree of height 10
+	SHAKE256_10_192 = initParams(0x13, SHAKE256, 24, 16, 10, 1)
+	// SHAKE256_16_192 is parameter set using SHAKE256/192 with n = 24, w = 16 and a Merkle Tree of height 16
+	SHAKE256_16_192 = initParams(0x14, SHAKE256, 24, 16, 16, 1)
+	// SHAKE256_20_192 is parameter set using SHAKE256/192 with n = 24, w = 16 and a Merkle Tree of height 20
+	SHAKE256_20_192 = initParams(0x15, SHAKE256, 24, 16, 20, 1)
+)
+
+var (
+	// SHA2_20_2_192 is XMSS^MT parameter set using SHA-256/192 with n = 24, w = 16, total height 20 and 2 layers
+	SHA2_20_2_192 = initParams(0x21, SHA2, 24, 16, 20, 2)
+	// SHA2_20_4_192 is XMSS^MT parameter set using SHA-256/192 with n = 24, w = 16, total height 20 and 4 layers
+	SHA2_20_4_192 = initParams(0x22, SHA2, 24, 16, 20, 4)
+	// SHA2_40_2_192 is XMSS^MT parameter set using SHA-256/192 with n = 24, w = 16, total height 40 and 2 layers
+	SHA2_40_2_192 = initParams(0x23, SHA2, 24, 16, 40, 2)
+	// SHA2_40_4_192 is XMSS^MT parameter set using SHA-256/192 with n = 24, w = 16, total height 40 and 4 layers
+	SHA2_40_4_192 = initParams(0x24, SHA2, 24, 16, 40, 4)
+	// SHA2_40_8_192 is XMSS^MT parameter set using SHA-256/192 with n = 24, w = 16, total height 40 and 8 layers
+	SHA2_40_8_192 = initParams(0x25, SHA2, 24, 16, 40, 8)
+	// SHA2_60_3_192 is XMSS^MT parameter set using SHA-256/192 with n = 24, w = 16, total height 60 and 3 layers
+	SHA2_60_3_192 = initParams(0x26, SHA2, 24, 16, 60, 3)
+	// SHA2_60_6_192 is XMSS^MT parameter set using SHA-256/192 with n = 24, w = 16, total height 60 and 6 layers
+	SHA2_60_6_192 = initParams(0x27, SHA2, 24, 16, 60, 6)
+	// SHA2_60_12_192 is XMSS^MT parameter set using SHA-256/192 with n = 24, w = 16, total height 60 and 12 layers
+	SHA2_60_12_192 = initParams(0x28, SHA2, 24, 16, 60, 12)
+)
+
+var (
+	// SHAKE256_20_2_256 is XMSS^MT parameter set using SHAKE256/256 with n = 32, w = 16, total height 20 and 2 layers
+	SHAKE256_20_2_256 = initParams(0x29, SHAKE256, 32, 16, 20, 2)
+	// SHAKE256_20_4_256 is XMSS^MT parameter set using SHAKE256/256 with n = 32, w = 16, total height 20 and 4 layers
+	SHAKE256_20_4_256 = initParams(0x2a, SHAKE256, 32, 16, 20, 4)
+	// SHAKE256_40_2_256 is XMSS^MT parameter set using SHAKE256/256 with n = 32, w = 16, total height 40 and 2 layers
+	SHAKE256_40_2_256 = initParams(0x2b, SHAKE256, 32, 16, 40, 2)
+	// SHAKE256_40_4_256 is XMSS^MT parameter set using SHAKE256/256 with n = 32, w = 16, total height 40 and 4 layers
+	SHAKE256_40_4_256 = initParams(0x2c, SHAKE256, 32, 16, 40, 4)
+	// SHAKE256_40_8_256 is XMSS^MT parameter set using SHAKE256/256 with n = 32, w = 16, total height 40 and 8 layers
+	SHAKE256_40_8_256 = initParams(0x2d, SHAKE256, 32, 16, 40, 8)
+	// SHAKE256_60_3_256 is XMSS^MT parameter set using SHAKE256/256 with n = 32, w = 16, total height 60 and 3 layers
+	SHAKE256_60_3_256 = initParams(0x2e, SHAKE256, 32, 16, 60, 3)
+	// SHAKE256_60_6_256 is XMSS^MT parameter set using SHAKE256/256 with n = 32, w = 16, total height 60 and 6 layers
+	SHAKE256_60_6_256 = initParams(0x2f, SHAKE256, 32, 16, 60, 6)
+	// SHAKE256_60_12_256 is XMSS^MT parameter set using SHAKE256/256 with n = 32, w = 16, total height 60 and 12 layers
+	SHAKE256_60_12_256 = initParams(0x30, SHAKE256, 32, 16, 60, 12)
+)
+
+var (
+	// SHAKE256_20_2_192 is XMSS^MT parameter set using SHAKE256/192 with n = 24, w = 16, total height 20 and 2 layers
+	SHAKE256_20_2_192 = initParams(0x31, SHAKE256, 24, 16, 20, 2)
+	// SHAKE256_20_4_192 is XMSS^MT parameter set using SHAKE256/192 with n = 24, w = 16, total height 20 and 4 layers
+	SHAKE256_20_4_192 = initParams(0x32, SHAKE256, 24, 16, 20, 4)
+	// SHAKE256_40_2_192 is XMSS^MT parameter set using SHAKE256/192 with n = 24, w = 16, total height 40 and 2 layers
+	SHAKE256_40_2_192 = initParams(0x33, SHAKE256, 24, 16, 40, 2)
+	// SHAKE256_40_4_192 is XMSS^MT parameter set using SHAKE256/192 with n = 24, w = 16, total height 40 and 4 layers
+	SHAKE256_40_4_192 = initParams(0x34, SHAKE256, 24, 16, 40, 4)
+	// SHAKE256_40_8_192 is XMSS^MT parameter set using SHAKE256/192 with n = 24, w = 16, total height 40 and 8 layers
+	SHAKE256_40_8_192 = initParams(0x35, SHAKE256, 24, 16, 40, 8)
+	// SHAKE256_60_3_192 is XMSS^MT parameter set using SHAKE256/192 with n = 24, w = 16, total height 60 and 3 layers
+	SHAKE256_60_3_192 = initParams(0x36, SHAKE256, 24, 16, 60, 3)
+	// SHAKE256_60_6_192 is XMSS^MT parameter set using SHAKE256/192 with n = 24, w = 16, total height 60 and 6 layers
+	SHAKE256_60_6_192 = initParams(0x37, SHAKE256, 24, 16, 60, 6)
+	// SHAKE256_60_12_192 is XMSS^MT parameter set using SHAKE256/192 with n = 24, w = 16, total height 60 and 12 layers
+	SHAKE256_60_12_192 = initParams(0x38, SHAKE256, 24, 16, 60, 12)
 )
@@ -0,0 +1,100 @@
+package xmss
+
+import "testing"
+
+func TestNewParams(t *testing.T) {
+	t.Parallel()
+	valid := []struct {
+		hash       HashFunc
+		n, w, h, d int
+		wlen       uint32
+	}{
+		{SHA2, 32, 4, 4, 1, 133},
+		{SHA2, 32, 256, 8, 1, 34},
+		{SHAKE128, 32, 16, 12, 2, 67},
+		{SHAKE256, 24, 16, 8, 4, 51},
+		{SHA2, 64, 4, 6, 3, 261},
+	}
+	for _, v := range valid {
+		params, err := NewParams(v.hash, v.n, v.w, v.h, v.d)
+		if err != nil {
+			t.Errorf("NewParams(%v, %d, %d, %d, %d) failed: %v", v.hash, v.n, v.w, v.h, v.d, err)
+			continue
+		}
+		if params.wlen != v.wlen {
+			t.Errorf("NewParams(%v, %d, %d, %d, %d) has len %d, expected %d", v.hash, v.n, v.w, v.h, v.d, params.wlen, v.wlen)
+		}
+	}
+
+	invalid := []struct {
+		hash       HashFunc
+		n, w, h, d int
+	}{
+		{SHA2, 16, 16, 10, 1},
+		{SHAKE128, 64, 16, 10, 1},
+		{HashFunc(7), 32, 16, 10, 1},
+		{SHA2, 32, 8, 10, 1},
+		{SHA2, 32, 16, 0, 1},
+		{SHA2, 32, 16, 64, 8},
+		{SHA2, 32, 16, 10, 0},
+		{SHA2, 32, 16, 10, 3},
+		{SHA2, 32, 16, 32, 1},
+	}
+	for _, v := range invalid {
+		if _, err := NewParams(v.hash, v.n, v.w, v.h, v.d); err == nil {
+			t.Errorf("NewParams(%v, %d, %d, %d, %d) did not fail", v.hash, v.n, v.w, v.h, v.d)
+		}
+	}
+}
+
+func TestCustomParams(t *testing.T) {
+	t.Parallel()
+	for _, w := range []int{4, 256} {
+		params, err := NewParams(SHA2, 32, w, 8, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testSignVerify(t, params)
+	}
+}
+
+func TestParamsAccessors(t *testing.T) {
+	t.Parallel()
+	// Sizes from RFC 8391, Table 3 and Table 4
+	params := SHA2_20_4_256
+	got := []int{params.N(), params.W(), params.Len(), params.Height(), params.Layers(), params.TreeHeight(),
+		params.IndexBytes(), params.PublicKeyBytes(), params.PrivateKeyBytes(), params.SignBytes()}
+	expected := []int{32, 16, 67, 20, 4, 5, 3, 64, 131, 9251}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Accessor %d returned %d, expected %d", i, got[i], expected[i])
+		}
+	}
+	if params.Hash() != SHA2 {
+		t.Errorf("Unexpected hash function %v", params.Hash())
+	}
+	if params.MaxSignatures() != 1<<20 {
+		t.Errorf("Unexpected maximum number of signatures %d", params.MaxSignatures())
+	}
+	if SHA2_10_256.SignBytes() != 2500 {
+		t.Errorf("Unexpected signature length %d", SHA2_10_256.SignBytes())
+	}
+	if params.KeyDerivation() != KeyDerivationLegacy || SHA2_10_192.KeyDerivation() != KeyDerivationSP800208 ||
+		SHAKE256_10_256.KeyDerivation() != KeyDerivationSP800208 {
+		t.Error("Unexpected default key derivation")
+	}
+	other, err := params.WithKeyDerivation(KeyDerivationSP800208)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.KeyDerivation() != KeyDerivationSP800208 || params.KeyDerivation() != KeyDerivationLegacy || other.OID() != params.OID() {
+		t.Error("WithKeyDerivation did not return a modified copy")
+	}
+	if _, err := params.WithKeyDerivation(KeyDerivation(2)); err == nil {
+		t.Error("Unknown key derivation was accepted")
+	}
+	expectedString := "XMSSMT-SHA2_20/4_256 (OID 0x00000002): n = 32, w = 16, len = 67, h = 20, d = 4, 1048576 signatures of 9251 bytes"
+	if params.String() != expectedString {
+		t.Errorf("Unexpected summary %q", params.String())
+	}
+}
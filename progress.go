@@ -0,0 +1,57 @@
+package xmss
+
+import (
+	"context"
+	"sync"
+)
+
+// Progress is called during long computations with the number of leaves
+// (WOTS+ key pairs) computed so far out of total. It is never called
+// concurrently, but may be called from a goroutine other than the caller's.
+// A slow Progress slows down the computation.
+type Progress func(done, total uint64)
+
+// progress carries the context and the Progress of a computation. It is
+// shared by the hashers of all goroutines working on it. A nil progress is
+// never cancelled and reports nothing.
+type progress struct {
+	ctx context.Context
+	fn  Progress
+
+	mu    sync.Mutex
+	done  uint64
+	total uint64
+}
+
+func newProgress(ctx context.Context, fn Progress) *progress {
+	return &progress{ctx: ctx, fn: fn}
+}
+
+// expect adds leaves to the total that is reported
+func (p *progress) expect(leaves uint64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.total += leaves
+	p.mu.Unlock()
+}
+
+// err returns the error of the context once it is done
+func (p *progress) err() error {
+	if p == nil {
+		return nil
+	}
+	return p.ctx.Err()
+}
+
+// leafDone records a computed leaf
+func (p *progress) leafDone() {
+	if p == nil || p.fn == nil {
+		return
+	}
+	p.mu.Lock()
+	p.done++
+	p.fn(p.done, p.total)
+	p.mu.Unlock()
+}
@@ -0,0 +1,109 @@
+package xmss
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestGenerateKeyContext(t *testing.T) {
+	t.Parallel()
+	params, err := NewParams(SHA2, 32, 16, 5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := make([]byte, params.n)
+	want, err := NewKeyFromSeeds(params, seed, seed, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{1, 2} {
+		var last uint64
+		prv, err := NewKeyFromSeedsContext(context.Background(), params, seed, seed, seed, workers, func(done, total uint64) {
+			if total != 1<<5 || done != last+1 {
+				t.Errorf("Progress %d/%d after %d", done, total, last)
+			}
+			last = done
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last != 1<<5 {
+			t.Errorf("%d workers reported %d leaves", workers, last)
+		}
+		if !bytes.Equal(prv.prv, want.prv) {
+			t.Errorf("%d workers computed another key", workers)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err = NewKeyFromSeedsContext(ctx, params, seed, seed, seed, workers, func(done, total uint64) {
+			if done == 3 {
+				cancel()
+			}
+			if done > 3+uint64(workers) {
+				t.Errorf("%d workers computed leaf %d after cancellation", workers, done)
+			}
+		})
+		if err != context.Canceled {
+			t.Errorf("%d workers: cancelled key generation returned %v", workers, err)
+		}
+	}
+}
+
+func TestSignMessageContext(t *testing.T) {
+	t.Parallel()
+	params, err := NewParams(SHA2, 32, 16, 6, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := make([]byte, params.n)
+	gen, err := NewKeyFromSeeds(params, seed, seed, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := []byte("progress")
+
+	// A PrivateXMSS computes both trees for every signature
+	legacy := make(PrivateXMSS, len(gen.prv))
+	copy(legacy, gen.prv)
+	var leaves uint64
+	signature, err := legacy.SignMessageContext(context.Background(), params, m, func(done, total uint64) {
+		if total != 2<<3 {
+			t.Errorf("Signing reported %d leaves in total", total)
+		}
+		leaves = done
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaves != 2<<3 || !Verify(params, make([]byte, len(signature)), signature, gen.PublicKey().pub) {
+		t.Errorf("Signing computed %d leaves or returned an invalid signature", leaves)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := legacy.SignMessageContext(ctx, params, m, nil); err != context.Canceled {
+		t.Errorf("Cancelled signature returned %v", err)
+	}
+	if legacy.Index(params) != 2 {
+		t.Errorf("Cancelled signature left the index at %d", legacy.Index(params))
+	}
+
+	// A loaded PrivateKey rebuilds its state once
+	prv, err := NewPrivateKey(params, legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prv.SignMessageContext(ctx, m, nil); err != context.Canceled {
+		t.Errorf("Cancelled rebuild returned %v", err)
+	}
+	for i, want := range []uint64{2 << 3, 0} {
+		leaves = 0
+		if _, err := prv.SignMessageContext(context.Background(), m, func(done, total uint64) { leaves = done }); err != nil {
+			t.Fatal(err)
+		}
+		if leaves != want {
+			t.Errorf("Signature %d computed %d leaves, expected %d", i, leaves, want)
+		}
+	}
+}
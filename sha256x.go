@@ -0,0 +1,256 @@
+package xmss
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// maxLanes is the number of SHA-256 computations a sha256Lanes holds
+const maxLanes = 8
+
+// laneWords holds the same 32-bit word of every lane
+type laneWords [maxLanes]uint32
+
+// sha256Lanes holds independent SHA-256 compressions that are computed in
+// lockstep. The states and blocks are stored word by word, h[i][l] is word i
+// of the state of lane l, so that one SIMD register holds the same word of
+// several lanes.
+type sha256Lanes struct {
+	h [8]laneWords
+	// w holds the block in its first 16 words, the other words are scratch
+	// space for the message schedule
+	w [64]laneWords
+}
+
+// laneBackend compresses the blocks of the first lanes lanes of a sha256Lanes
+type laneBackend struct {
+	name  string
+	lanes int
+	block func(x *sha256Lanes)
+}
+
+var (
+	// laneBackends lists the backends the CPU supports, the fastest first,
+	// and defaultLanes is the one WOTS chains are hashed with. It is nil if
+	// hashing the chains one after another with crypto/sha256 is faster,
+	// which has its own assembly and uses the SHA extensions of the CPU.
+	// Both are set by the platform specific init.
+	laneBackends []laneBackend
+	defaultLanes *laneBackend
+
+	genericLanes = laneBackend{"generic", maxLanes, func(x *sha256Lanes) { blockGeneric(x, maxLanes) }}
+)
+
+var sha256IV = [8]uint32{
+	0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a,
+	0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+}
+
+var sha256K = [64]uint32{
+	0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+	0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+	0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+	0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+	0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+	0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+	0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+	0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+}
+
+// laneK holds the round constants broadcast to every lane, for the SIMD
+// backends
+var laneK [64]laneWords
+
+func init() {
+	for i, k := range sha256K {
+		laneK[i] = broadcast(k)
+	}
+}
+
+func broadcast(v uint32) (w laneWords) {
+	for l := range w {
+		w[l] = v
+	}
+	return
+}
+
+// blockGeneric compresses the first lanes lanes of x one after another
+func blockGeneric(x *sha256Lanes, lanes int) {
+	var w [64]uint32
+	for l := 0; l < lanes; l++ {
+		for i := 0; i < 16; i++ {
+			w[i] = x.w[i][l]
+		}
+		for i := 16; i < 64; i++ {
+			v1 := w[i-2]
+			t1 := bits.RotateLeft32(v1, -17) ^ bits.RotateLeft32(v1, -19) ^ (v1 >> 10)
+			v2 := w[i-15]
+			t2 := bits.RotateLeft32(v2, -7) ^ bits.RotateLeft32(v2, -18) ^ (v2 >> 3)
+			w[i] = t1 + w[i-7] + t2 + w[i-16]
+		}
+
+		a, b, c, d := x.h[0][l], x.h[1][l], x.h[2][l], x.h[3][l]
+		e, f, g, h := x.h[4][l], x.h[5][l], x.h[6][l], x.h[7][l]
+		for i := 0; i < 64; i++ {
+			t1 := h + (bits.RotateLeft32(e, -6) ^ bits.RotateLeft32(e, -11) ^ bits.RotateLeft32(e, -25)) +
+				((e & f) ^ (^e & g)) + sha256K[i] + w[i]
+			t2 := (bits.RotateLeft32(a, -2) ^ bits.RotateLeft32(a, -13) ^ bits.RotateLeft32(a, -22)) +
+				((a & b) ^ (a & c) ^ (b & c))
+			h, g, f, e, d, c, b, a = g, f, e, d+t1, c, b, a, t1+t2
+		}
+		x.h[0][l] += a
+		x.h[1][l] += b
+		x.h[2][l] += c
+		x.h[3][l] += d
+		x.h[4][l] += e
+		x.h[5][l] += f
+		x.h[6][l] += g
+		x.h[7][l] += h
+	}
+}
+
+// chainLanes computes WOTS+ chains for SHA-256 with n = 32, advancing one
+// chain on each lane of a laneBackend at a time. Each F call is four
+// compressions: the key and the mask resume from the state after
+// toByte(3, 32) || PUB_SEED and take one block each, F itself takes two.
+type chainLanes struct {
+	backend laneBackend
+	x       sha256Lanes
+	pubMid  [8]laneWords
+
+	// The address words of every lane, the ones above the chain address are
+	// the same for all lanes
+	addr      [5]laneWords
+	chainAddr laneWords
+	hashAddr  laneWords
+
+	// The current value of the chain on every lane, the chain it belongs
+	// to or -1 for an idle lane, and the remaining steps
+	val   [8]laneWords
+	chain [maxLanes]int
+	left  [maxLanes]uint32
+}
+
+// newChainLanes returns a chainLanes for the key with the given public seed
+func newChainLanes(pubSeed []byte, backend laneBackend) *chainLanes {
+	c := &chainLanes{backend: backend}
+	x := &c.x
+	for i := 0; i < 8; i++ {
+		x.h[i][0] = sha256IV[i]
+		x.w[i][0] = 0
+	}
+	x.w[7][0] = domainPRF
+	for i := 0; i < 8; i++ {
+		x.w[8+i][0] = binary.BigEndian.Uint32(pubSeed[4*i:])
+	}
+	blockGeneric(x, 1)
+	for i := range c.pubMid {
+		c.pubMid[i] = broadcast(x.h[i][0])
+	}
+	return c
+}
+
+// padBlock sets the second half of the block to the SHA-256 padding of a
+// 96-byte message, the length of the PRF and F inputs
+func (x *sha256Lanes) padBlock() {
+	x.w[8] = broadcast(0x80000000)
+	for i := 9; i < 15; i++ {
+		x.w[i] = laneWords{}
+	}
+	x.w[15] = broadcast(96 * 8)
+}
+
+// step applies F to the value on every lane, with the chain and hash address
+// of the lane
+func (c *chainLanes) step() {
+	x := &c.x
+	var key, mask [8]laneWords
+	for km := uint32(0); km < 2; km++ {
+		x.h = c.pubMid
+		copy(x.w[:5], c.addr[:])
+		x.w[5] = c.chainAddr
+		x.w[6] = c.hashAddr
+		x.w[7] = broadcast(km)
+		x.padBlock()
+		c.backend.block(x)
+		if km == 0 {
+			key = x.h
+		} else {
+			mask = x.h
+		}
+	}
+
+	for i := range x.h {
+		x.h[i] = broadcast(sha256IV[i])
+		x.w[i] = laneWords{}
+		x.w[8+i] = key[i]
+	}
+	x.w[7] = broadcast(domainF)
+	c.backend.block(x)
+	for i := range c.val {
+		for l := range x.w[i] {
+			x.w[i][l] = c.val[i][l] ^ mask[i][l]
+		}
+	}
+	x.padBlock()
+	c.backend.block(x)
+	c.val = x.h
+}
+
+// load puts the next chain with a step to do on lane l, starting at chain
+// *next. Chains without steps are copied to out directly. It reports whether
+// the lane got a chain.
+func (c *chainLanes) load(l int, next *int, out, in []byte, start, steps []uint32) bool {
+	for *next < len(start) {
+		i := *next
+		*next++
+		if steps[i] == 0 {
+			copy(out[32*i:32*(i+1)], in[32*i:32*(i+1)])
+			continue
+		}
+		for j := range c.val {
+			c.val[j][l] = binary.BigEndian.Uint32(in[32*i+4*j:])
+		}
+		c.chain[l] = i
+		c.chainAddr[l] = uint32(i)
+		c.hashAddr[l] = start[i]
+		c.left[l] = steps[i]
+		return true
+	}
+	c.chain[l] = -1
+	return false
+}
+
+// chains is chains for SHA-256 with n = 32
+func (c *chainLanes) chains(out, in []byte, start, steps []uint32, a *address) {
+	for i := range c.addr {
+		c.addr[i] = broadcast(a[i])
+	}
+	lanes := c.backend.lanes
+	next, active := 0, 0
+	for l := 0; l < lanes; l++ {
+		if c.load(l, &next, out, in, start, steps) {
+			active++
+		}
+	}
+	for active > 0 {
+		c.step()
+		for l := 0; l < lanes; l++ {
+			if c.chain[l] < 0 {
+				continue
+			}
+			c.hashAddr[l]++
+			c.left[l]--
+			if c.left[l] > 0 {
+				continue
+			}
+			i := c.chain[l]
+			for j := range c.val {
+				binary.BigEndian.PutUint32(out[32*i+4*j:], c.val[j][l])
+			}
+			if !c.load(l, &next, out, in, start, steps) {
+				active--
+			}
+		}
+	}
+}
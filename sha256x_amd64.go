@@ -0,0 +1,57 @@
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+package xmss
+
+// block8AVX2 compresses all 8 lanes of x with AVX2
+//
+//go:noescape
+func block8AVX2(x *sha256Lanes, k *[64]laneWords)
+
+// block4SSE2 compresses the first 4 lanes of x with SSE2
+//
+//go:noescape
+func block4SSE2(x *sha256Lanes, k *[64]laneWords)
+
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+func xgetbv() (eax, edx uint32)
+
+// cpuFeatures reports whether the CPU and the operating system support
+// AVX2, and whether the CPU has the SHA extensions
+func cpuFeatures() (avx2, sha bool) {
+	maxID, _, _, _ := cpuid(0, 0)
+	if maxID < 7 {
+		return false, false
+	}
+	_, ebx7, _, _ := cpuid(7, 0)
+	sha = ebx7&(1<<29) != 0
+
+	_, _, ecx1, _ := cpuid(1, 0)
+	const osxsave, avx = 1 << 27, 1 << 28
+	if ecx1&osxsave == 0 || ecx1&avx == 0 {
+		return false, sha
+	}
+	// The OS must save the XMM and YMM registers
+	if xcr0, _ := xgetbv(); xcr0&6 != 6 {
+		return false, sha
+	}
+	return ebx7&(1<<5) != 0, sha
+}
+
+func init() {
+	// SSE2 is part of amd64
+	sse2 := laneBackend{"sse2", 4, func(x *sha256Lanes) { block4SSE2(x, &laneK) }}
+	laneBackends = []laneBackend{sse2, genericLanes}
+
+	// 8 AVX2 lanes beat crypto/sha256 even with the SHA extensions, 4 SSE2
+	// lanes only without them
+	avx2, sha := cpuFeatures()
+	switch {
+	case avx2:
+		avx2 := laneBackend{"avx2", 8, func(x *sha256Lanes) { block8AVX2(x, &laneK) }}
+		laneBackends = append([]laneBackend{avx2}, laneBackends...)
+		defaultLanes = &laneBackends[0]
+	case !sha:
+		defaultLanes = &laneBackends[0]
+	}
+}
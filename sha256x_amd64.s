@@ -0,0 +1,310 @@
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+#include "textflag.h"
+
+// SHA-256 on the lanes of a sha256Lanes. The state of the lanes is h at
+// offset 0, the block w at offset 256, each word of all 8 lanes takes a
+// 32-byte row. The message schedule is written to the rows 16 to 63 of w.
+// The AVX2 functions hold the word of all 8 lanes in a Y register, the SSE2
+// ones the word of the first 4 lanes in an X register.
+
+// The registers a to h hold the state, AX points to the message schedule
+// and BX to the round constants.
+#define ROUND_AVX2(a, b, c, d, e, f, g, h, off) \
+	VMOVDQU off(AX), Y8; \
+	VPADDD  off(BX), Y8, Y8; \
+	VPADDD  Y8, h, h; \
+	VPSRLD  $6, e, Y8; \
+	VPSLLD  $26, e, Y9; \
+	VPXOR   Y9, Y8, Y8; \
+	VPSRLD  $11, e, Y9; \
+	VPXOR   Y9, Y8, Y8; \
+	VPSLLD  $21, e, Y9; \
+	VPXOR   Y9, Y8, Y8; \
+	VPSRLD  $25, e, Y9; \
+	VPXOR   Y9, Y8, Y8; \
+	VPSLLD  $7, e, Y9; \
+	VPXOR   Y9, Y8, Y8; \
+	VPADDD  Y8, h, h; \
+	VPAND   f, e, Y8; \
+	VPANDN  g, e, Y9; \
+	VPXOR   Y9, Y8, Y8; \
+	VPADDD  Y8, h, h; \
+	VPADDD  h, d, d; \
+	VPSRLD  $2, a, Y8; \
+	VPSLLD  $30, a, Y9; \
+	VPXOR   Y9, Y8, Y8; \
+	VPSRLD  $13, a, Y9; \
+	VPXOR   Y9, Y8, Y8; \
+	VPSLLD  $19, a, Y9; \
+	VPXOR   Y9, Y8, Y8; \
+	VPSRLD  $22, a, Y9; \
+	VPXOR   Y9, Y8, Y8; \
+	VPSLLD  $10, a, Y9; \
+	VPXOR   Y9, Y8, Y8; \
+	VPADDD  Y8, h, h; \
+	VPOR    b, a, Y8; \
+	VPAND   c, Y8, Y8; \
+	VPAND   b, a, Y9; \
+	VPOR    Y9, Y8, Y8; \
+	VPADDD  Y8, h, h
+
+// func block8AVX2(x *sha256Lanes, k *[64]laneWords)
+TEXT ·block8AVX2(SB), NOSPLIT, $0-16
+	MOVQ x+0(FP), DI
+	MOVQ k+8(FP), SI
+
+	// w[i] = σ1(w[i-2]) + w[i-7] + σ0(w[i-15]) + w[i-16]
+	LEAQ 256(DI), AX
+	MOVQ $48, CX
+
+schedule8:
+	VMOVDQU 448(AX), Y0
+	VPSRLD  $17, Y0, Y1
+	VPSLLD  $15, Y0, Y2
+	VPXOR   Y2, Y1, Y1
+	VPSRLD  $19, Y0, Y2
+	VPXOR   Y2, Y1, Y1
+	VPSLLD  $13, Y0, Y2
+	VPXOR   Y2, Y1, Y1
+	VPSRLD  $10, Y0, Y2
+	VPXOR   Y2, Y1, Y1
+	VMOVDQU 32(AX), Y0
+	VPSRLD  $7, Y0, Y3
+	VPSLLD  $25, Y0, Y2
+	VPXOR   Y2, Y3, Y3
+	VPSRLD  $18, Y0, Y2
+	VPXOR   Y2, Y3, Y3
+	VPSLLD  $14, Y0, Y2
+	VPXOR   Y2, Y3, Y3
+	VPSRLD  $3, Y0, Y2
+	VPXOR   Y2, Y3, Y3
+	VPADDD  Y3, Y1, Y1
+	VPADDD  288(AX), Y1, Y1
+	VPADDD  (AX), Y1, Y1
+	VMOVDQU Y1, 512(AX)
+	ADDQ    $32, AX
+	DECQ    CX
+	JNZ     schedule8
+
+	VMOVDQU (DI), Y0
+	VMOVDQU 32(DI), Y1
+	VMOVDQU 64(DI), Y2
+	VMOVDQU 96(DI), Y3
+	VMOVDQU 128(DI), Y4
+	VMOVDQU 160(DI), Y5
+	VMOVDQU 192(DI), Y6
+	VMOVDQU 224(DI), Y7
+	LEAQ    256(DI), AX
+	MOVQ    SI, BX
+	MOVQ    $8, CX
+
+rounds8:
+	ROUND_AVX2(Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7, 0)
+	ROUND_AVX2(Y7, Y0, Y1, Y2, Y3, Y4, Y5, Y6, 32)
+	ROUND_AVX2(Y6, Y7, Y0, Y1, Y2, Y3, Y4, Y5, 64)
+	ROUND_AVX2(Y5, Y6, Y7, Y0, Y1, Y2, Y3, Y4, 96)
+	ROUND_AVX2(Y4, Y5, Y6, Y7, Y0, Y1, Y2, Y3, 128)
+	ROUND_AVX2(Y3, Y4, Y5, Y6, Y7, Y0, Y1, Y2, 160)
+	ROUND_AVX2(Y2, Y3, Y4, Y5, Y6, Y7, Y0, Y1, 192)
+	ROUND_AVX2(Y1, Y2, Y3, Y4, Y5, Y6, Y7, Y0, 224)
+	ADDQ $256, AX
+	ADDQ $256, BX
+	DECQ CX
+	JNZ  rounds8
+
+	VPADDD  (DI), Y0, Y0
+	VMOVDQU Y0, (DI)
+	VPADDD  32(DI), Y1, Y1
+	VMOVDQU Y1, 32(DI)
+	VPADDD  64(DI), Y2, Y2
+	VMOVDQU Y2, 64(DI)
+	VPADDD  96(DI), Y3, Y3
+	VMOVDQU Y3, 96(DI)
+	VPADDD  128(DI), Y4, Y4
+	VMOVDQU Y4, 128(DI)
+	VPADDD  160(DI), Y5, Y5
+	VMOVDQU Y5, 160(DI)
+	VPADDD  192(DI), Y6, Y6
+	VMOVDQU Y6, 192(DI)
+	VPADDD  224(DI), Y7, Y7
+	VMOVDQU Y7, 224(DI)
+	VZEROUPPER
+	RET
+
+// As ROUND_AVX2 with 2-operand SSE2 instructions. The rows are not 16-byte
+// aligned, so memory is only accessed with MOVOU.
+#define ROUND_SSE2(a, b, c, d, e, f, g, h, off) \
+	MOVOU off(AX), X8; \
+	MOVOU off(BX), X9; \
+	PADDL X9, X8; \
+	PADDL X8, h; \
+	MOVO  e, X8; \
+	PSRLL $6, X8; \
+	MOVO  e, X9; \
+	PSLLL $26, X9; \
+	PXOR  X9, X8; \
+	MOVO  e, X9; \
+	PSRLL $11, X9; \
+	PXOR  X9, X8; \
+	MOVO  e, X9; \
+	PSLLL $21, X9; \
+	PXOR  X9, X8; \
+	MOVO  e, X9; \
+	PSRLL $25, X9; \
+	PXOR  X9, X8; \
+	MOVO  e, X9; \
+	PSLLL $7, X9; \
+	PXOR  X9, X8; \
+	PADDL X8, h; \
+	MOVO  e, X8; \
+	PAND  f, X8; \
+	MOVO  e, X9; \
+	PANDN g, X9; \
+	PXOR  X9, X8; \
+	PADDL X8, h; \
+	PADDL h, d; \
+	MOVO  a, X8; \
+	PSRLL $2, X8; \
+	MOVO  a, X9; \
+	PSLLL $30, X9; \
+	PXOR  X9, X8; \
+	MOVO  a, X9; \
+	PSRLL $13, X9; \
+	PXOR  X9, X8; \
+	MOVO  a, X9; \
+	PSLLL $19, X9; \
+	PXOR  X9, X8; \
+	MOVO  a, X9; \
+	PSRLL $22, X9; \
+	PXOR  X9, X8; \
+	MOVO  a, X9; \
+	PSLLL $10, X9; \
+	PXOR  X9, X8; \
+	PADDL X8, h; \
+	MOVO  a, X8; \
+	POR   b, X8; \
+	PAND  c, X8; \
+	MOVO  a, X9; \
+	PAND  b, X9; \
+	POR   X9, X8; \
+	PADDL X8, h
+
+// func block4SSE2(x *sha256Lanes, k *[64]laneWords)
+TEXT ·block4SSE2(SB), NOSPLIT, $0-16
+	MOVQ x+0(FP), DI
+	MOVQ k+8(FP), SI
+
+	LEAQ 256(DI), AX
+	MOVQ $48, CX
+
+schedule4:
+	MOVOU 448(AX), X0
+	MOVO  X0, X1
+	PSRLL $17, X1
+	MOVO  X0, X2
+	PSLLL $15, X2
+	PXOR  X2, X1
+	MOVO  X0, X2
+	PSRLL $19, X2
+	PXOR  X2, X1
+	MOVO  X0, X2
+	PSLLL $13, X2
+	PXOR  X2, X1
+	PSRLL $10, X0
+	PXOR  X0, X1
+	MOVOU 32(AX), X0
+	MOVO  X0, X3
+	PSRLL $7, X3
+	MOVO  X0, X2
+	PSLLL $25, X2
+	PXOR  X2, X3
+	MOVO  X0, X2
+	PSRLL $18, X2
+	PXOR  X2, X3
+	MOVO  X0, X2
+	PSLLL $14, X2
+	PXOR  X2, X3
+	PSRLL $3, X0
+	PXOR  X0, X3
+	PADDL X3, X1
+	MOVOU 288(AX), X2
+	PADDL X2, X1
+	MOVOU (AX), X2
+	PADDL X2, X1
+	MOVOU X1, 512(AX)
+	ADDQ  $32, AX
+	DECQ  CX
+	JNZ   schedule4
+
+	MOVOU (DI), X0
+	MOVOU 32(DI), X1
+	MOVOU 64(DI), X2
+	MOVOU 96(DI), X3
+	MOVOU 128(DI), X4
+	MOVOU 160(DI), X5
+	MOVOU 192(DI), X6
+	MOVOU 224(DI), X7
+	LEAQ  256(DI), AX
+	MOVQ  SI, BX
+	MOVQ  $8, CX
+
+rounds4:
+	ROUND_SSE2(X0, X1, X2, X3, X4, X5, X6, X7, 0)
+	ROUND_SSE2(X7, X0, X1, X2, X3, X4, X5, X6, 32)
+	ROUND_SSE2(X6, X7, X0, X1, X2, X3, X4, X5, 64)
+	ROUND_SSE2(X5, X6, X7, X0, X1, X2, X3, X4, 96)
+	ROUND_SSE2(X4, X5, X6, X7, X0, X1, X2, X3, 128)
+	ROUND_SSE2(X3, X4, X5, X6, X7, X0, X1, X2, 160)
+	ROUND_SSE2(X2, X3, X4, X5, X6, X7, X0, X1, 192)
+	ROUND_SSE2(X1, X2, X3, X4, X5, X6, X7, X0, 224)
+	ADDQ $256, AX
+	ADDQ $256, BX
+	DECQ CX
+	JNZ  rounds4
+
+	MOVOU (DI), X8
+	PADDL X8, X0
+	MOVOU X0, (DI)
+	MOVOU 32(DI), X8
+	PADDL X8, X1
+	MOVOU X1, 32(DI)
+	MOVOU 64(DI), X8
+	PADDL X8, X2
+	MOVOU X2, 64(DI)
+	MOVOU 96(DI), X8
+	PADDL X8, X3
+	MOVOU X3, 96(DI)
+	MOVOU 128(DI), X8
+	PADDL X8, X4
+	MOVOU X4, 128(DI)
+	MOVOU 160(DI), X8
+	PADDL X8, X5
+	MOVOU X5, 160(DI)
+	MOVOU 192(DI), X8
+	PADDL X8, X6
+	MOVOU X6, 192(DI)
+	MOVOU 224(DI), X8
+	PADDL X8, X7
+	MOVOU X7, 224(DI)
+	RET
+
+// func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+TEXT ·cpuid(SB), NOSPLIT, $0-24
+	MOVL eaxArg+0(FP), AX
+	MOVL ecxArg+4(FP), CX
+	CPUID
+	MOVL AX, eax+8(FP)
+	MOVL BX, ebx+12(FP)
+	MOVL CX, ecx+16(FP)
+	MOVL DX, edx+20(FP)
+	RET
+
+// func xgetbv() (eax, edx uint32)
+TEXT ·xgetbv(SB), NOSPLIT, $0-8
+	MOVL $0, CX
+	XGETBV
+	MOVL AX, eax+0(FP)
+	MOVL DX, edx+4(FP)
+	RET
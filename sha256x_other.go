@@ -0,0 +1,10 @@
+//go:build !amd64 || purego
+// +build !amd64 purego
+
+package xmss
+
+// The portable backend is slower than crypto/sha256, so the chains are not
+// hashed on lanes
+func init() {
+	laneBackends = []laneBackend{genericLanes}
+}
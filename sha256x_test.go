@@ -0,0 +1,80 @@
+package xmss
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+// TestLaneBackends hashes a different one-block message on every lane and
+// compares the results to crypto/sha256
+func TestLaneBackends(t *testing.T) {
+	t.Parallel()
+	r := rand.New(rand.NewSource(1))
+	for _, b := range laneBackends {
+		var x sha256Lanes
+		msgs := make([][]byte, b.lanes)
+		for l := range msgs {
+			msgs[l] = make([]byte, 55)
+			r.Read(msgs[l])
+			block := append(append([]byte(nil), msgs[l]...), 0x80)
+			block = append(block, make([]byte, 8)...)
+			binary.BigEndian.PutUint64(block[56:], 55*8)
+			for i := 0; i < 16; i++ {
+				x.w[i][l] = binary.BigEndian.Uint32(block[4*i:])
+			}
+			for i := range x.h {
+				x.h[i][l] = sha256IV[i]
+			}
+		}
+		b.block(&x)
+		for l, m := range msgs {
+			want := sha256.Sum256(m)
+			got := make([]byte, 32)
+			for i := range x.h {
+				binary.BigEndian.PutUint32(got[4*i:], x.h[i][l])
+			}
+			if !bytes.Equal(got, want[:]) {
+				t.Errorf("%s: lane %d differs from crypto/sha256", b.name, l)
+			}
+		}
+	}
+}
+
+// TestChainLanes computes chains of every length on the lanes of every
+// backend and compares them to chain
+func TestChainLanes(t *testing.T) {
+	t.Parallel()
+	params, err := NewParams(SHA2, 32, 16, 4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := params.n
+	seed := bytes.Repeat([]byte{5}, n)
+	hs := newHasher(params, seed, seed)
+	in := make([]byte, params.wotsSignLen)
+	rand.New(rand.NewSource(2)).Read(in)
+	start := make([]uint32, params.wlen)
+	steps := make([]uint32, params.wlen)
+	for i := range start {
+		start[i] = uint32(i) % uint32(params.w)
+		steps[i] = uint32(params.w) - 1 - start[i]
+	}
+
+	var a address
+	a.initRandom()
+	want := make([]byte, len(in))
+	for i := range start {
+		a.setChainAddr(uint32(i))
+		chain(hs, want[i*n:(i+1)*n], in[i*n:(i+1)*n], start[i], steps[i], &a)
+	}
+	for _, b := range laneBackends {
+		got := make([]byte, len(in))
+		newChainLanes(seed, b).chains(got, in, start, steps, &a)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: chains differ from chain", b.name)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package xmss
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// FIPS 202 SHAKE128 and SHAKE256, implemented here to keep the module free of
+// external dependencies. Only the fixed-output-length use the XMSS hash
+// functions need is supported, exposed through the hash.Hash interface.
+
+var errInvalidShakeState = errors.New("xmss: invalid SHAKE state")
+
+const (
+	shake128Rate = 168
+	shake256Rate = 136
+)
+
+var keccakRoundConstants = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808a, 0x8000000080008000,
+	0x000000000000808b, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008a, 0x0000000000000088, 0x0000000080008009, 0x000000008000000a,
+	0x000000008000808b, 0x800000000000008b, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800a, 0x800000008000000a,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+// Rotation offsets of the rho step, in the order lanes are visited by pi
+var keccakRotc = [24]uint{
+	1, 3, 6, 10, 15, 21, 28, 36, 45, 55, 2, 14,
+	27, 41, 56, 8, 25, 43, 62, 18, 39, 61, 20, 44,
+}
+
+// Lane indices visited by the pi step
+var keccakPiln = [24]int{
+	10, 7, 11, 17, 18, 3, 5, 16, 8, 21, 24, 4,
+	15, 23, 19, 13, 12, 2, 20, 14, 22, 9, 6, 1,
+}
+
+func rotl64(x uint64, n uint) uint64 {
+	return x<<n | x>>(64-n)
+}
+
+// keccakF1600 applies the Keccak-f[1600] permutation to the state a
+func keccakF1600(a *[25]uint64) {
+	var bc [5]uint64
+	for round := 0; round < 24; round++ {
+		// Theta
+		for i := 0; i < 5; i++ {
+			bc[i] = a[i] ^ a[i+5] ^ a[i+10] ^ a[i+15] ^ a[i+20]
+		}
+		for i := 0; i < 5; i++ {
+			t := bc[(i+4)%5] ^ rotl64(bc[(i+1)%5], 1)
+			for j := 0; j < 25; j += 5 {
+				a[j+i] ^= t
+			}
+		}
+
+		// Rho and pi
+		t := a[1]
+		for i := 0; i < 24; i++ {
+			j := keccakPiln[i]
+			bc[0] = a[j]
+			a[j] = rotl64(t, keccakRotc[i])
+			t = bc[0]
+		}
+
+		// Chi
+		for j := 0; j < 25; j += 5 {
+			for i := 0; i < 5; i++ {
+				bc[i] = a[j+i]
+			}
+			for i := 0; i < 5; i++ {
+				a[j+i] ^= (^bc[(i+1)%5]) & bc[(i+2)%5]
+			}
+		}
+
+		// Iota
+		a[0] ^= keccakRoundConstants[round]
+	}
+}
+
+// shake is a SHAKE sponge that produces a fixed number of output bytes
+type shake struct {
+	a      [25]uint64
+	buf    []byte
+	rate   int
+	outLen int
+}
+
+func newShake128(outLen int) *shake {
+	return &shake{rate: shake128Rate, outLen: outLen, buf: make([]byte, 0, shake128Rate)}
+}
+
+func newShake256(outLen int) *shake {
+	return &shake{rate: shake256Rate, outLen: outLen, buf: make([]byte, 0, shake256Rate)}
+}
+
+// absorb XORs a full rate-sized block into the state and permutes it
+func (s *shake) absorb(block []byte) {
+	for i := 0; i < s.rate/8; i++ {
+		s.a[i] ^= binary.LittleEndian.Uint64(block[8*i:])
+	}
+	keccakF1600(&s.a)
+}
+
+func (s *shake) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		if len(s.buf) == 0 && len(p) >= s.rate {
+			s.absorb(p[:s.rate])
+			p = p[s.rate:]
+			continue
+		}
+		k := copy(s.buf[len(s.buf):s.rate], p)
+		s.buf = s.buf[:len(s.buf)+k]
+		p = p[k:]
+		if len(s.buf) == s.rate {
+			s.absorb(s.buf)
+			s.buf = s.buf[:0]
+		}
+	}
+	return written, nil
+}
+
+// Sum appends outLen bytes of output to b. It does not change the
+// underlying state, so more data can be written afterwards.
+func (s *shake) Sum(b []byte) []byte {
+	a := s.a
+	var block [shake128Rate]byte
+	copy(block[:], s.buf)
+	// SHAKE domain separation and pad10*1
+	block[len(s.buf)] ^= 0x1f
+	block[s.rate-1] ^= 0x80
+	for i := 0; i < s.rate/8; i++ {
+		a[i] ^= binary.LittleEndian.Uint64(block[8*i:])
+	}
+	keccakF1600(&a)
+
+	for remaining := s.outLen; ; {
+		for i := 0; i < s.rate/8; i++ {
+			binary.LittleEndian.PutUint64(block[8*i:], a[i])
+		}
+		k := remaining
+		if k > s.rate {
+			k = s.rate
+		}
+		b = append(b, block[:k]...)
+		remaining -= k
+		if remaining == 0 {
+			break
+		}
+		keccakF1600(&a)
+	}
+	return b
+}
+
+// shakeStateMagic starts a marshaled shake state
+const shakeStateMagic = "shk\x01"
+
+// AppendBinary appends the state of the sponge to b, see MarshalBinary
+func (s *shake) AppendBinary(b []byte) ([]byte, error) {
+	b = append(b, shakeStateMagic...)
+	b = append(b, byte(s.rate), byte(len(s.buf)))
+	for _, lane := range s.a {
+		b = append(b, byte(lane), byte(lane>>8), byte(lane>>16), byte(lane>>24),
+			byte(lane>>32), byte(lane>>40), byte(lane>>48), byte(lane>>56))
+	}
+	return append(b, s.buf...), nil
+}
+
+// MarshalBinary saves the state of the sponge, so that absorbing a common
+// prefix can be skipped by restoring it with UnmarshalBinary
+func (s *shake) MarshalBinary() ([]byte, error) {
+	return s.AppendBinary(make([]byte, 0, len(shakeStateMagic)+2+200+len(s.buf)))
+}
+
+// UnmarshalBinary restores a state saved by MarshalBinary
+func (s *shake) UnmarshalBinary(b []byte) error {
+	hdr := len(shakeStateMagic) + 2
+	if len(b) < hdr+200 || string(b[:len(shakeStateMagic)]) != shakeStateMagic ||
+		int(b[hdr-2]) != s.rate || int(b[hdr-1]) >= s.rate || len(b) != hdr+200+int(b[hdr-1]) {
+		return errInvalidShakeState
+	}
+	for i := range s.a {
+		s.a[i] = binary.LittleEndian.Uint64(b[hdr+8*i:])
+	}
+	s.buf = append(s.buf[:0], b[hdr+200:]...)
+	return nil
+}
+
+func (s *shake) Reset() {
+	s.a = [25]uint64{}
+	s.buf = s.buf[:0]
+}
+
+func (s *shake) Size() int {
+	return s.outLen
+}
+
+func (s *shake) BlockSize() int {
+	return s.rate
+}
@@ -0,0 +1,40 @@
+package xmss
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestShake(t *testing.T) {
+	t.Parallel()
+	a3 := bytes.Repeat([]byte{0xa3}, 200)
+	vectors := []struct {
+		name   string
+		h      *shake
+		msg    []byte
+		digest string
+	}{
+		{"SHAKE128_empty", newShake128(32), nil, "7f9c2ba4e88f827d616045507605853ed73b8093f6efbc88eb1a6eacfa66ef26"},
+		{"SHAKE128_a3", newShake128(32), a3, "131ab8d2b594946b9c81333f9bb6e0ce75c3b93104fa3469d3917457385da037"},
+		{"SHAKE128_long_output", newShake128(200), nil, "7f9c2ba4e88f827d616045507605853ed73b8093f6efbc88eb1a6eacfa66ef263cb1eea988004b93103cfb0aeefd2a686e01fa4a58e8a3639ca8a1e3f9ae57e235b8cc873c23dc62b8d260169afa2f75ab916a58d974918835d25e6a435085b2badfd6dfaac359a5efbb7bcc4b59d538df9a04302e10c8bc1cbf1a0b3a5120ea17cda7cfad765f5623474d368ccca8af0007cd9f5e4c849f167a580b14aabdefaee7eef47cb0fca9767be1fda69419dfb927e9df07348b196691abaeb580b32def58538b8d23f877"},
+		{"SHAKE256_empty", newShake256(64), nil, "46b9dd2b0ba88d13233b3feb743eeb243fcd52ea62b81b82b50c27646ed5762fd75dc4ddd8c0f200cb05019d67b592f6fc821c49479ab48640292eacb3b7c4be"},
+		{"SHAKE256_a3", newShake256(64), a3, "cd8a920ed141aa0407a22d59288652e9d9f1a7ee0c1e7c1ca699424da84a904d2d700caae7396ece96604440577da4f3aa22aeb8857f961c4cd8e06f0ae6610b"},
+	}
+	for _, v := range vectors {
+		expected, _ := hex.DecodeString(v.digest)
+		v.h.Write(v.msg)
+		if out := v.h.Sum(nil); !bytes.Equal(out, expected) {
+			t.Errorf("%s failed. Got %x", v.name, out)
+		}
+
+		// Absorbing byte by byte must give the same result
+		v.h.Reset()
+		for i := range v.msg {
+			v.h.Write(v.msg[i : i+1])
+		}
+		if out := v.h.Sum(nil); !bytes.Equal(out, expected) {
+			t.Errorf("%s failed for incremental writes. Got %x", v.name, out)
+		}
+	}
+}
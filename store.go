@@ -0,0 +1,129 @@
+package xmss
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// StateStore persists the state of a private key. XMSS is stateful: an index
+// that is rolled back after a crash makes the key reuse one-time signatures,
+// so a PrivateKey with a StateStore commits every index update before it
+// releases a signature (NIST SP 800-208, Section 8.1).
+type StateStore interface {
+	// Load returns the most recently committed private key
+	Load() (PrivateXMSS, error)
+	// Commit stores prv durably. It must not return before the data
+	// survives a crash, and a crash during Commit must leave either the
+	// previous or the new key behind.
+	Commit(prv PrivateXMSS) error
+}
+
+// TraversalStore is a StateStore that also keeps the BDS traversal state of
+// the key, like the state xmss_core_fast.c of the reference implementation
+// stores with the key. A key loaded from a TraversalStore continues signing
+// where it stopped instead of computing its trees again. The state only saves
+// time: it is committed after the key, and a missing or damaged state is
+// rebuilt on the next signature.
+type TraversalStore interface {
+	StateStore
+	// LoadTraversal returns the most recently committed traversal state
+	LoadTraversal() ([]byte, error)
+	// CommitTraversal replaces the stored traversal state with state. A
+	// crash must leave either the previous or the new state behind.
+	CommitTraversal(state []byte) error
+}
+
+// FileStore is a StateStore that keeps the private key in a single file. A
+// commit writes a temporary file next to it, syncs it and renames it over the
+// previous state, so the file always holds a complete key. It is a
+// TraversalStore that keeps the traversal state in a second file with the
+// suffix ".bds".
+type FileStore struct {
+	path string
+}
+
+// NewFileStore returns a FileStore that keeps the key in the file at path
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Steps of writeFileAtomic, in order. fileStoreHook is called before each of
+// them and fileStoreWriter wraps the temporary file, which allows tests to
+// simulate a crash at every write point, including within the write.
+const (
+	stepCreate  = "create"
+	stepWrite   = "write"
+	stepSync    = "sync"
+	stepClose   = "close"
+	stepRename  = "rename"
+	stepSyncDir = "syncdir"
+)
+
+var (
+	fileStoreHook   = func(step string) {}
+	fileStoreWriter = func(w io.Writer) io.Writer { return w }
+)
+
+// Load reads the committed private key
+func (s *FileStore) Load() (PrivateXMSS, error) {
+	return ioutil.ReadFile(s.path)
+}
+
+// Commit atomically replaces the stored private key with prv
+func (s *FileStore) Commit(prv PrivateXMSS) error {
+	return writeFileAtomic(s.path, prv)
+}
+
+// LoadTraversal reads the committed traversal state
+func (s *FileStore) LoadTraversal() ([]byte, error) {
+	return ioutil.ReadFile(s.path + ".bds")
+}
+
+// CommitTraversal atomically replaces the stored traversal state
+func (s *FileStore) CommitTraversal(state []byte) error {
+	return writeFileAtomic(s.path+".bds", state)
+}
+
+// writeFileAtomic durably writes the concatenation of parts to a file with
+// permissions 0600 at path and renames it over the previous file. Every file
+// that holds key material is written by it.
+func writeFileAtomic(path string, parts ...[]byte) error {
+	fileStoreHook(stepCreate)
+	// The temporary file gets a fresh random name and is created exclusively
+	// with permissions 0600, so that neither a stale file with looser
+	// permissions nor a planted symlink receives the data
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	fileStoreHook(stepWrite)
+	w := fileStoreWriter(f)
+	for _, p := range parts {
+		if _, err = w.Write(p); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		fileStoreHook(stepSync)
+		err = f.Sync()
+	}
+	fileStoreHook(stepClose)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	fileStoreHook(stepRename)
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// Make the rename itself durable
+	fileStoreHook(stepSyncDir)
+	return syncDir(filepath.Dir(path))
+}
@@ -0,0 +1,411 @@
+package xmss
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+const (
+	crashEnvStep  = "XMSS_CRASH_STEP"
+	crashEnvDir   = "XMSS_CRASH_DIR"
+	crashExitCode = 3
+	crashIndex    = 5
+	// crashPartial crashes after half of the key is written
+	crashPartial = "partial"
+)
+
+var crashMessage = []byte("crash test message")
+
+func crashParams(t *testing.T) *Params {
+	params, err := NewParams(SHA2, 32, 16, 4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return params
+}
+
+func TestFileStore(t *testing.T) {
+	t.Parallel()
+	params := crashParams(t)
+	dir, err := ioutil.TempDir("", "xmss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "key")
+	store := NewFileStore(path)
+
+	// Neither a stale temporary file nor a planted symlink at a predictable
+	// name may receive the key
+	if runtime.GOOS != "windows" {
+		if err := ioutil.WriteFile(path+".tmp", nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(dir, "planted"), path+".tmp.link"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seed := make([]byte, params.n)
+	prv, err := NewKeyFromSeeds(params, seed, seed, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prv.SetStateStore(store); err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+			t.Fatalf("Key file %v, %v", info, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "planted")); !os.IsNotExist(err) {
+			t.Errorf("Symlink target was written: %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := prv.SignMessage(crashMessage); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loaded, err := LoadPrivateKey(params, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.Key(), prv.Key()) || loaded.Index() != 3 {
+		t.Errorf("Loaded key at index %d does not match the key in memory", loaded.Index())
+	}
+
+	// A failing commit must not release a signature
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prv.SignMessage(crashMessage); err == nil {
+		t.Error("Signing succeeded although the state could not be committed")
+	}
+	if prv.Index() != 3 {
+		t.Errorf("Failed commit moved the index to %d", prv.Index())
+	}
+}
+
+// TestFileStoreCrash kills a child process at every write point of
+// FileStore.Commit while it signs, and checks that the stored state is intact
+// and was advanced before any signature left the process.
+func TestFileStoreCrash(t *testing.T) {
+	t.Parallel()
+	params := crashParams(t)
+	seed := make([]byte, params.n)
+	prv, err := NewKeyFromSeeds(params, seed, seed, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(prv.prv[:params.indexBytes], toByte(crashIndex, int(params.indexBytes)))
+	pub := prv.PublicKey()
+
+	steps := []string{stepCreate, stepWrite, crashPartial, stepSync, stepClose, stepRename, stepSyncDir, ""}
+	for _, step := range steps {
+		dir, err := ioutil.TempDir("", "xmss")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		store := NewFileStore(filepath.Join(dir, "key"))
+		if err := store.Commit(prv.prv); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command(os.Args[0], "-test.run=^TestFileStoreCrashHelper$")
+		cmd.Env = append(os.Environ(), crashEnvStep+"="+step, crashEnvDir+"="+dir)
+		out, err := cmd.CombinedOutput()
+		exitErr, crashed := err.(*exec.ExitError)
+		if step != "" && (!crashed || exitErr.ExitCode() != crashExitCode) {
+			t.Fatalf("Child did not crash before step %q: %v\n%s", step, err, out)
+		}
+		if step == "" && err != nil {
+			t.Fatalf("Child failed: %v\n%s", err, out)
+		}
+
+		loaded, err := LoadPrivateKey(params, store)
+		if err != nil {
+			t.Fatalf("Crash before step %q left an unreadable state: %v", step, err)
+		}
+		idx := loaded.Index()
+		if idx != crashIndex && idx != crashIndex+1 {
+			t.Fatalf("Crash before step %q left index %d", step, idx)
+		}
+		if !bytes.Equal(loaded.Key()[params.indexBytes:], prv.prv[params.indexBytes:]) {
+			t.Fatalf("Crash before step %q corrupted the key", step)
+		}
+
+		sig, err := ioutil.ReadFile(filepath.Join(dir, "sig"))
+		if os.IsNotExist(err) {
+			if step == "" {
+				t.Fatal("Child did not release a signature")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if step != "" {
+			t.Fatalf("Signature was released although the child crashed before step %q", step)
+		}
+		if idx != crashIndex+1 {
+			t.Fatalf("Signature was released, but the stored index is still %d", idx)
+		}
+		m := make([]byte, len(sig))
+		if err := VerifyMessage(params, m, sig, pub.pub); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestFileStoreCrashHelper signs once in a child process started by
+// TestFileStoreCrash and exits before the configured step of the commit
+func TestFileStoreCrashHelper(t *testing.T) {
+	dir := os.Getenv(crashEnvDir)
+	if dir == "" {
+		t.Skip("only run as a child process of TestFileStoreCrash")
+	}
+	step := os.Getenv(crashEnvStep)
+	fileStoreHook = func(s string) {
+		if s == step {
+			os.Exit(crashExitCode)
+		}
+	}
+	if step == crashPartial {
+		fileStoreWriter = func(w io.Writer) io.Writer { return crashingWriter{w} }
+	}
+	prv, err := LoadPrivateKey(crashParams(t), NewFileStore(filepath.Join(dir, "key")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := prv.SignMessage(crashMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Releasing the signature
+	if err := ioutil.WriteFile(filepath.Join(dir, "sig"), sig, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// crashingWriter writes the first half of the data and exits like a crash
+type crashingWriter struct {
+	w io.Writer
+}
+
+func (c crashingWriter) Write(p []byte) (int, error) {
+	c.w.Write(p[:len(p)/2])
+	os.Exit(crashExitCode)
+	return 0, nil
+}
+
+// countingStore counts the commits to a FileStore
+type countingStore struct {
+	*FileStore
+	commits int
+}
+
+func (s *countingStore) Commit(prv PrivateXMSS) error {
+	s.commits++
+	return s.FileStore.Commit(prv)
+}
+
+func TestReserve(t *testing.T) {
+	t.Parallel()
+	params := crashParams(t)
+	dir, err := ioutil.TempDir("", "xmss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := &countingStore{FileStore: NewFileStore(filepath.Join(dir, "key"))}
+
+	seed := make([]byte, params.n)
+	prv, err := NewKeyFromSeeds(params, seed, seed, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prv.SetStateStore(store); err != nil {
+		t.Fatal(err)
+	}
+	if err := prv.Reserve(5); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := prv.SignMessage(crashMessage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if store.commits != 2 {
+		t.Errorf("Expected 2 commits, got %d", store.commits)
+	}
+	if prv.Index() != 3 || prv.Reserved() != 2 {
+		t.Errorf("Unexpected index %d and %d reserved indices", prv.Index(), prv.Reserved())
+	}
+
+	// A restart skips the unused reserved indices
+	loaded, err := LoadPrivateKey(params, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Index() != 5 || loaded.Reserved() != 0 || loaded.Remaining() != params.MaxSignatures()-5 {
+		t.Errorf("Loaded key at index %d with %d reserved and %d remaining", loaded.Index(), loaded.Reserved(), loaded.Remaining())
+	}
+
+	// Signing past the reservation commits a single index again
+	for i := 0; i < 3; i++ {
+		if _, err := prv.SignMessage(crashMessage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if store.commits != 3 || prv.Reserved() != 0 {
+		t.Errorf("Expected 3 commits and no reserved indices, got %d and %d", store.commits, prv.Reserved())
+	}
+
+	// Reservations end at the last index
+	if err := prv.Reserve(100); err != nil {
+		t.Fatal(err)
+	}
+	if prv.Reserved() != prv.Remaining() {
+		t.Errorf("Reserved %d indices, but only %d remain", prv.Reserved(), prv.Remaining())
+	}
+	for prv.Remaining() > 0 {
+		if _, err := prv.SignMessage(crashMessage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := prv.SignMessage(crashMessage); err != ErrKeyExhausted {
+		t.Errorf("Expected %v, got %v", ErrKeyExhausted, err)
+	}
+	if err := prv.Reserve(1); err != ErrKeyExhausted {
+		t.Errorf("Expected %v, got %v", ErrKeyExhausted, err)
+	}
+}
+
+// TestReserveToEnd reserves the last indices of an XMSS^MT key whose index of
+// h/8 bytes has no room for 2^h
+func TestReserveToEnd(t *testing.T) {
+	t.Parallel()
+	params, err := NewParams(SHA2, 32, 16, 8, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "xmss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewFileStore(filepath.Join(dir, "key"))
+
+	gen, err := GenerateKey(params, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := gen.Key()
+	raw.setIndex(params, 250)
+	prv, err := NewPrivateKey(params, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prv.SetStateStore(store); err != nil {
+		t.Fatal(err)
+	}
+	if err := prv.Reserve(100); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stored key is exhausted, not back at index 0
+	loaded, err := LoadPrivateKey(params, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Index() != params.MaxSignatures() || loaded.Remaining() != 0 {
+		t.Fatalf("Loaded key at index %d with %d remaining", loaded.Index(), loaded.Remaining())
+	}
+	if _, err := loaded.SignMessage(crashMessage); err != ErrKeyExhausted {
+		t.Errorf("Expected %v, got %v", ErrKeyExhausted, err)
+	}
+
+	// The key in memory signs the reserved indices up to the end
+	for prv.Remaining() > 0 {
+		if _, err := prv.SignMessage(crashMessage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if prv.Index() != params.MaxSignatures() {
+		t.Errorf("Key stopped at index %d", prv.Index())
+	}
+	if _, err := prv.SignMessage(crashMessage); err != ErrKeyExhausted {
+		t.Errorf("Expected %v, got %v", ErrKeyExhausted, err)
+	}
+}
+
+func TestFileStoreTraversal(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "xmss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "key")
+	store := NewFileStore(path)
+
+	prv, _ := testKey(t, 6, 2)
+	params := prv.params
+	if err := prv.SetStateStore(store); err != nil {
+		t.Fatal(err)
+	}
+	testBDS(t, prv, 3, false)
+
+	// The loaded key continues with the stored state
+	loaded, err := LoadPrivateKey(params, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.trav == nil || loaded.trav.next != 3 {
+		t.Fatal("Traversal state was not loaded")
+	}
+	testBDS(t, loaded, 1, true)
+	if err := loaded.Reserve(4); err != nil {
+		t.Fatal(err)
+	}
+	testBDS(t, loaded, 2, true)
+
+	// A restart skips the reserved indices. The state catches up with them,
+	// which takes it into the next tree of the bottom layer.
+	loaded, err = LoadPrivateKey(params, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Index() != 8 || loaded.trav == nil || loaded.trav.next != 4 {
+		t.Fatalf("Loaded key at index %d with traversal state %v", loaded.Index(), loaded.trav)
+	}
+	testBDS(t, loaded, 3, true)
+
+	// A damaged state is rebuilt
+	data, err := ioutil.ReadFile(path + ".bds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 1
+	if err := ioutil.WriteFile(path+".bds", data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = LoadPrivateKey(params, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.trav != nil {
+		t.Error("Damaged traversal state was loaded")
+	}
+	testBDS(t, loaded, 2, false)
+}
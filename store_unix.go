@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package xmss
+
+import "os"
+
+// syncDir flushes the directory entry of a renamed file to disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package xmss
+
+// syncDir is a no-op on Windows, where directories cannot be opened for
+// syncing. The durability of the rename is left to the NTFS journal.
+func syncDir(dir string) error {
+	return nil
+}
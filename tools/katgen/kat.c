@@ -0,0 +1,108 @@
+/*
+ * kat writes one known-answer vector of go-xmss with xmss-reference
+ * (https://github.com/XMSS/xmss-reference), see reference.sh.
+ *
+ * Usage: kat <name> <oid> <index> <directory>
+ *
+ * The key is generated from the seeds SHAKE256("go-xmss KAT " || name || " "
+ * || label, n) for the labels SK_SEED, SK_PRF and PUB_SEED, and signs the
+ * message of message_data at the given index. The files are
+ *
+ *     message_data  message signed by every vector
+ *     {name}.key    OID || index || SK_SEED || SK_PRF || root || PUB_SEED
+ *     {name}.pub    OID || root || PUB_SEED
+ *     {name}.sig    the signature without the message
+ *
+ * where the private key holds the index of the signature.
+ */
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#include "fips202.h"
+#include "params.h"
+#include "utils.h"
+#include "xmss_core.h"
+
+static const char *labels[] = {"SK_SEED", "SK_PRF", "PUB_SEED"};
+
+static void write_file(const char *dir, const char *name, const char *ext,
+                       const unsigned char *a, size_t alen,
+                       const unsigned char *b, size_t blen)
+{
+    char path[4096];
+    FILE *f;
+
+    snprintf(path, sizeof(path), "%s/%s%s", dir, name, ext);
+    f = fopen(path, "wb");
+    if (f == NULL || fwrite(a, 1, alen, f) != alen ||
+        fwrite(b, 1, blen, f) != blen || fclose(f) != 0) {
+        perror(path);
+        exit(1);
+    }
+}
+
+int main(int argc, char **argv)
+{
+    xmss_params params;
+    unsigned char message[64 + 25];
+    unsigned char oid_bytes[4];
+    unsigned char *seed, *pk, *sk, *sm;
+    unsigned long long smlen;
+    unsigned long long idx;
+    uint32_t oid;
+    const char *name;
+    char label[256];
+    int i, underscores = 0;
+
+    if (argc != 5) {
+        fprintf(stderr, "usage: %s <name> <oid> <index> <directory>\n", argv[0]);
+        return 2;
+    }
+    name = argv[1];
+    oid = (uint32_t)strtoul(argv[2], NULL, 0);
+    idx = strtoull(argv[3], NULL, 0);
+
+    /* XMSS^MT names carry the number of layers, e.g. SHA2_20_4_256 */
+    for (i = 0; name[i] != '\0'; i++) {
+        underscores += name[i] == '_';
+    }
+    if ((underscores == 3 ? xmssmt_parse_oid(&params, oid)
+                          : xmss_parse_oid(&params, oid)) != 0) {
+        fprintf(stderr, "unknown OID %s for %s\n", argv[2], name);
+        return 1;
+    }
+
+    for (i = 0; i < 64; i++) {
+        message[i] = (unsigned char)i;
+    }
+    memcpy(message + 64, "go-xmss known-answer test", 25);
+
+    seed = malloc(3 * params.n);
+    pk = malloc(params.pk_bytes);
+    sk = malloc(params.sk_bytes);
+    sm = malloc(params.sig_bytes + sizeof(message));
+    if (seed == NULL || pk == NULL || sk == NULL || sm == NULL) {
+        perror("malloc");
+        return 1;
+    }
+    for (i = 0; i < 3; i++) {
+        snprintf(label, sizeof(label), "go-xmss KAT %s %s", name, labels[i]);
+        shake256(seed + i * params.n, params.n,
+                 (const unsigned char *)label, strlen(label));
+    }
+
+    xmssmt_core_seed_keypair(&params, pk, sk, seed);
+    ull_to_bytes(sk, params.index_bytes, idx);
+    ull_to_bytes(oid_bytes, 4, oid);
+    write_file(argv[4], name, ".key", oid_bytes, 4, sk, params.sk_bytes);
+    write_file(argv[4], name, ".pub", oid_bytes, 4, pk, params.pk_bytes);
+
+    if (xmssmt_core_sign(&params, sk, sm, &smlen, message, sizeof(message)) != 0) {
+        fprintf(stderr, "signing failed for %s\n", name);
+        return 1;
+    }
+    write_file(argv[4], name, ".sig", sm, params.sig_bytes, NULL, 0);
+    write_file(argv[4], "message_data", "", message, sizeof(message), NULL, 0);
+    return 0;
+}
@@ -0,0 +1,33 @@
+#!/bin/sh
+# reference.sh writes the known-answer vectors of vectors.txt to
+# test/testdata/kat with xmss-reference and records its commit in UPSTREAM.
+#
+# Usage: reference.sh <xmss-reference checkout>
+#
+# It needs a C compiler and OpenSSL, which xmss-reference hashes with.
+# Afterwards, python3 xmss_kat.py checks the vectors against an independent
+# transcription of the specifications.
+set -e
+
+if [ $# -ne 1 ]; then
+	echo "usage: $0 <xmss-reference checkout>" >&2
+	exit 2
+fi
+ref=$(cd "$1" && pwd)
+here=$(cd "$(dirname "$0")" && pwd)
+out="$here/../../test/testdata/kat"
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+cc -O2 -I"$ref" -o "$tmp/kat" "$here/kat.c" \
+	"$ref/params.c" "$ref/hash.c" "$ref/fips202.c" "$ref/randombytes.c" \
+	"$ref/wots.c" "$ref/utils.c" "$ref/xmss_commons.c" "$ref/xmss_core.c" \
+	-lcrypto
+
+mkdir -p "$out"
+grep -v '^#' "$here/vectors.txt" | while read -r name oid idx; do
+	[ -n "$name" ] || continue
+	"$tmp/kat" "$name" "$oid" "$idx" "$out"
+	echo "$name"
+done
+git -C "$ref" rev-parse HEAD >"$out/UPSTREAM"
@@ -0,0 +1,381 @@
+#!/usr/bin/env python3
+"""Cross-check of the known-answer vectors of go-xmss.
+
+reference.sh writes the vectors of vectors.txt to test/testdata/kat with
+xmss-reference. This script recomputes them with a straightforward, slow
+transcription of RFC 8391 (Algorithms 1 to 16) with PRF_keygen of NIST SP
+800-208, Section 5.1, using only hashlib, and compares them with the files:
+
+    test/testdata/kat/message_data  message signed by every vector
+    test/testdata/kat/{name}.key    OID || index || SK_SEED || SK_PRF || root || PUB_SEED
+    test/testdata/kat/{name}.pub    OID || root || PUB_SEED
+    test/testdata/kat/{name}.sig    idx_sig || R || WOTS+ signatures and auth paths
+
+The private key holds the index of the signature, i.e. the key before signing.
+The seeds are SHAKE256("go-xmss KAT " || name || " " || label, n) for the
+labels SK_SEED, SK_PRF and PUB_SEED, as in kat.c.
+
+Run from this directory: python3 xmss_kat.py
+"""
+
+import hashlib
+import os
+import sys
+
+HERE = os.path.dirname(os.path.abspath(__file__))
+KAT_DIR = os.path.join(HERE, "..", "..", "test", "testdata", "kat")
+
+# The hash functions of the name prefixes, SHAKE is SHAKE128 in RFC 8391
+FUNCS = {"SHA2": "SHA2", "SHAKE": "SHAKE128", "SHAKE256": "SHAKE256"}
+
+
+def read_vectors():
+    """Returns name, OID, hash, n, h, d and index of the vectors in vectors.txt.
+    The names are those of the Go variables, e.g. SHA2_20_4_256 is
+    XMSSMT-SHA2_20/4_256."""
+    vectors = []
+    with open(os.path.join(HERE, "vectors.txt")) as f:
+        for line in f:
+            if not line.strip() or line.startswith("#"):
+                continue
+            name, oid, idx = line.split()
+            parts = name.split("_")
+            d = int(parts[2]) if len(parts) == 4 else 1
+            vectors.append((name, int(oid, 0), FUNCS[parts[0]], int(parts[-1]) // 8, int(parts[1]), d, int(idx, 0)))
+    return vectors
+
+
+MESSAGE = bytes(range(64)) + b"go-xmss known-answer test"
+
+
+def to_byte(x, y):
+    return x.to_bytes(y, "big")
+
+
+class Params:
+    def __init__(self, oid, func, n, h, d):
+        self.oid = oid
+        self.func = func
+        self.n = n
+        self.h = h
+        self.d = d
+        self.tree_height = h // d
+        self.w = 16
+        self.len1 = (8 * n + 3) // 4
+        self.len2 = 3
+        self.len = self.len1 + self.len2
+        # SP 800-208 shortens the padding of the n = 24 sets to 4 bytes
+        self.padding_len = 4 if n == 24 else n
+        self.index_bytes = 4 if d == 1 else (h + 7) // 8
+
+    def core(self, data):
+        if self.func == "SHA2":
+            if self.n == 64:
+                return hashlib.sha512(data).digest()
+            return hashlib.sha256(data).digest()[: self.n]
+        if self.func == "SHAKE128":
+            return hashlib.shake_128(data).digest(self.n)
+        return hashlib.shake_256(data).digest(self.n)
+
+
+class Adrs:
+    def __init__(self):
+        self.words = [0] * 8
+
+    def copy(self):
+        a = Adrs()
+        a.words = list(self.words)
+        return a
+
+    def bytes(self):
+        return b"".join(to_byte(x, 4) for x in self.words)
+
+    def set_layer(self, x):
+        self.words[0] = x
+
+    def set_tree(self, x):
+        self.words[1] = x >> 32
+        self.words[2] = x & 0xFFFFFFFF
+
+    def set_type(self, x):
+        # Changing the type clears the type-specific words
+        self.words[3] = x
+        self.words[4:8] = [0, 0, 0, 0]
+
+    # OTS hash address
+    def set_ots(self, x):
+        self.words[4] = x
+
+    def set_chain(self, x):
+        self.words[5] = x
+
+    def set_hash(self, x):
+        self.words[6] = x
+
+    # L-tree address
+    def set_ltree(self, x):
+        self.words[4] = x
+
+    # L-tree and hash tree address
+    def set_tree_height(self, x):
+        self.words[5] = x
+
+    def set_tree_index(self, x):
+        self.words[6] = x
+
+    def set_key_and_mask(self, x):
+        self.words[7] = x
+
+
+class XMSS:
+    def __init__(self, params, sk_seed, sk_prf, pub_seed):
+        self.p = params
+        self.sk_seed = sk_seed
+        self.sk_prf = sk_prf
+        self.pub_seed = pub_seed
+        self.trees = {}
+
+    # Section 5.1 of RFC 8391 and Section 5.1 of SP 800-208
+    def pad(self, x):
+        return to_byte(x, self.p.padding_len)
+
+    def prf(self, key, m):
+        return self.p.core(self.pad(3) + key + m)
+
+    def prf_keygen(self, adrs):
+        return self.p.core(self.pad(4) + self.sk_seed + self.pub_seed + adrs.bytes())
+
+    def h_msg(self, key, m):
+        return self.p.core(self.pad(2) + key + m)
+
+    # Section 4.1.5, F and H with the keys and bitmasks from PRF
+    def f(self, x, adrs):
+        adrs.set_key_and_mask(0)
+        key = self.prf(self.pub_seed, adrs.bytes())
+        adrs.set_key_and_mask(1)
+        bm = self.prf(self.pub_seed, adrs.bytes())
+        return self.p.core(self.pad(0) + key + bytes(a ^ b for a, b in zip(x, bm)))
+
+    def h(self, left, right, adrs):
+        adrs.set_key_and_mask(0)
+        key = self.prf(self.pub_seed, adrs.bytes())
+        adrs.set_key_and_mask(1)
+        bm0 = self.prf(self.pub_seed, adrs.bytes())
+        adrs.set_key_and_mask(2)
+        bm1 = self.prf(self.pub_seed, adrs.bytes())
+        m = bytes(a ^ b for a, b in zip(left, bm0)) + bytes(a ^ b for a, b in zip(right, bm1))
+        return self.p.core(self.pad(1) + key + m)
+
+    # Algorithm 1: base_w
+    def base_w(self, x, out_len):
+        out = []
+        total = 0
+        bits = 0
+        i = 0
+        for _ in range(out_len):
+            if bits == 0:
+                total = x[i]
+                i += 1
+                bits = 8
+            bits -= 4
+            out.append((total >> bits) & (self.p.w - 1))
+        return out
+
+    # Algorithm 2: chain
+    def chain(self, x, start, steps, adrs):
+        for i in range(start, start + steps):
+            adrs.set_hash(i)
+            x = self.f(x, adrs)
+        return x
+
+    def wots_sk(self, adrs):
+        sk = []
+        for i in range(self.p.len):
+            a = adrs.copy()
+            a.set_chain(i)
+            a.set_hash(0)
+            a.set_key_and_mask(0)
+            sk.append(self.prf_keygen(a))
+        return sk
+
+    # Algorithm 4: WOTS_genPK
+    def wots_pk(self, adrs):
+        sk = self.wots_sk(adrs)
+        pk = []
+        for i in range(self.p.len):
+            adrs.set_chain(i)
+            pk.append(self.chain(sk[i], 0, self.p.w - 1, adrs))
+        return pk
+
+    def msg_lengths(self, m):
+        msg = self.base_w(m, self.p.len1)
+        csum = sum(self.p.w - 1 - x for x in msg)
+        csum <<= 8 - ((self.p.len2 * 4) % 8)
+        csum_bytes = to_byte(csum, (self.p.len2 * 4 + 7) // 8)
+        return msg + self.base_w(csum_bytes, self.p.len2)
+
+    # Algorithm 5: WOTS_sign
+    def wots_sign(self, m, adrs):
+        sk = self.wots_sk(adrs)
+        sig = []
+        for i, b in enumerate(self.msg_lengths(m)):
+            adrs.set_chain(i)
+            sig.append(self.chain(sk[i], 0, b, adrs))
+        return sig
+
+    # Algorithm 6: WOTS_pkFromSig
+    def wots_pk_from_sig(self, sig, m, adrs):
+        pk = []
+        for i, b in enumerate(self.msg_lengths(m)):
+            adrs.set_chain(i)
+            pk.append(self.chain(sig[i], b, self.p.w - 1 - b, adrs))
+        return pk
+
+    # Algorithm 8: ltree
+    def ltree(self, pk, adrs):
+        pk = list(pk)
+        adrs.set_tree_height(0)
+        while len(pk) > 1:
+            nxt = []
+            for i in range(len(pk) // 2):
+                adrs.set_tree_index(i)
+                nxt.append(self.h(pk[2 * i], pk[2 * i + 1], adrs))
+            if len(pk) % 2 == 1:
+                nxt.append(pk[-1])
+            pk = nxt
+            adrs.set_tree_height(adrs.words[5] + 1)
+        return pk[0]
+
+    def leaf(self, layer, tree, i):
+        ots = Adrs()
+        ots.set_layer(layer)
+        ots.set_tree(tree)
+        ots.set_type(0)
+        ots.set_ots(i)
+        ltree = Adrs()
+        ltree.set_layer(layer)
+        ltree.set_tree(tree)
+        ltree.set_type(1)
+        ltree.set_ltree(i)
+        return self.ltree(self.wots_pk(ots), ltree)
+
+    def tree_levels(self, layer, tree):
+        """Returns every level of the tree, levels[0] are the leaves"""
+        if (layer, tree) in self.trees:
+            return self.trees[layer, tree]
+        levels = [[self.leaf(layer, tree, i) for i in range(1 << self.p.tree_height)]]
+        adrs = Adrs()
+        adrs.set_layer(layer)
+        adrs.set_tree(tree)
+        adrs.set_type(2)
+        for height in range(self.p.tree_height):
+            below = levels[-1]
+            level = []
+            for j in range(len(below) // 2):
+                adrs.set_tree_height(height)
+                adrs.set_tree_index(j)
+                level.append(self.h(below[2 * j], below[2 * j + 1], adrs))
+            levels.append(level)
+        self.trees[layer, tree] = levels
+        return levels
+
+    def root(self):
+        return self.tree_levels(self.p.d - 1, 0)[-1][0]
+
+    # Algorithms 11 and 15: XMSS_sign and XMSSMT_sign
+    def sign(self, m, idx, root):
+        p = self.p
+        r = self.prf(self.sk_prf, to_byte(idx, 32))
+        node = self.h_msg(r + root + to_byte(idx, p.n), m)
+        sig = to_byte(idx, p.index_bytes) + r
+        for layer in range(p.d):
+            leaf = (idx >> (layer * p.tree_height)) & ((1 << p.tree_height) - 1)
+            tree = idx >> ((layer + 1) * p.tree_height)
+            ots = Adrs()
+            ots.set_layer(layer)
+            ots.set_tree(tree)
+            ots.set_type(0)
+            ots.set_ots(leaf)
+            sig += b"".join(self.wots_sign(node, ots))
+            levels = self.tree_levels(layer, tree)
+            sig += b"".join(levels[k][(leaf >> k) ^ 1] for k in range(p.tree_height))
+            node = levels[-1][0]
+        assert node == root
+        return sig
+
+    # Algorithms 14 and 16: XMSS_verify and XMSSMT_verify
+    def verify(self, m, sig, root):
+        p = self.p
+        n = p.n
+        idx = int.from_bytes(sig[: p.index_bytes], "big")
+        r = sig[p.index_bytes : p.index_bytes + n]
+        node = self.h_msg(r + root + to_byte(idx, n), m)
+        sig = sig[p.index_bytes + n :]
+        for layer in range(p.d):
+            leaf = (idx >> (layer * p.tree_height)) & ((1 << p.tree_height) - 1)
+            tree = idx >> ((layer + 1) * p.tree_height)
+            ots = Adrs()
+            ots.set_layer(layer)
+            ots.set_tree(tree)
+            ots.set_type(0)
+            ots.set_ots(leaf)
+            wsig = [sig[i * n : (i + 1) * n] for i in range(p.len)]
+            sig = sig[p.len * n :]
+            ltree = Adrs()
+            ltree.set_layer(layer)
+            ltree.set_tree(tree)
+            ltree.set_type(1)
+            ltree.set_ltree(leaf)
+            node = self.ltree(self.wots_pk_from_sig(wsig, node, ots), ltree)
+            adrs = Adrs()
+            adrs.set_layer(layer)
+            adrs.set_tree(tree)
+            adrs.set_type(2)
+            for k in range(p.tree_height):
+                auth = sig[k * n : (k + 1) * n]
+                adrs.set_tree_height(k)
+                adrs.set_tree_index(leaf >> (k + 1))
+                if (leaf >> k) & 1:
+                    node = self.h(auth, node, adrs)
+                else:
+                    node = self.h(node, auth, adrs)
+            sig = sig[p.tree_height * n :]
+        return node == root and not sig
+
+
+def seeds(name, n):
+    """Fixed seeds SK_SEED, SK_PRF and PUB_SEED, different for every set"""
+    out = []
+    for label in (b"SK_SEED", b"SK_PRF", b"PUB_SEED"):
+        out.append(hashlib.shake_256(b"go-xmss KAT " + name.encode() + b" " + label).digest(n))
+    return out
+
+
+def main():
+    failed = False
+    with open(os.path.join(KAT_DIR, "message_data"), "rb") as f:
+        if f.read() != MESSAGE:
+            print("message_data: differs")
+            failed = True
+    for name, oid, func, n, h, d, idx in read_vectors():
+        p = Params(oid, func, n, h, d)
+        sk_seed, sk_prf, pub_seed = seeds(name, n)
+        x = XMSS(p, sk_seed, sk_prf, pub_seed)
+        root = x.root()
+        sig = x.sign(MESSAGE, idx, root)
+        assert x.verify(MESSAGE, sig, root)
+        oid_bytes = to_byte(oid, 4)
+        key = oid_bytes + to_byte(idx, p.index_bytes) + sk_seed + sk_prf + root + pub_seed
+        files = {".key": key, ".pub": oid_bytes + root + pub_seed, ".sig": sig}
+        for ext, data in files.items():
+            with open(os.path.join(KAT_DIR, name + ext), "rb") as f:
+                if f.read() != data:
+                    print(name + ext + ": differs")
+                    failed = True
+        print(name, "checked")
+    if failed:
+        sys.exit(1)
+
+
+if __name__ == "__main__":
+    main()
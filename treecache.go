@@ -0,0 +1,257 @@
+package xmss
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"os"
+)
+
+// treeCacheMagic starts every tree cache file
+var treeCacheMagic = []byte("XMSSTREE")
+
+// maxTreeCacheHeight bounds the total height of keys a tree cache is built
+// for, which holds about 2^h nodes
+const maxTreeCacheHeight = 32
+
+// TreeCache holds every node of every tree of a key, so that a signature
+// reads its authentication paths in O(h) instead of computing them. For XMSS
+// it needs (2^(h+1) - 1) * n bytes, 4 MiB for SHA2_16_256, and slightly more
+// for XMSS^MT. Every path read from the cache is checked against the root of
+// its tree before it is used, and the top root against the root of the key.
+// A TreeCache is read-only and can be shared by the keys with the same seeds.
+type TreeCache struct {
+	params  *Params
+	root    []byte
+	pubSeed []byte
+	nodes   []byte
+	unmap   func() error
+}
+
+// treeCacheNodes returns the number of nodes in the trees of all layers
+func treeCacheNodes(params *Params) (uint64, error) {
+	if params.fullHeight > maxTreeCacheHeight {
+		return 0, fmt.Errorf("xmss: tree cache for %s would be too large", params.name)
+	}
+	th := params.treeHeight
+	perTree := uint64(1)<<(th+1) - 1
+	var total uint64
+	for i := uint32(0); i < uint32(params.d); i++ {
+		total += perTree << ((uint32(params.d) - 1 - i) * th)
+	}
+	if total*uint64(params.n) > uint64(^uint(0)>>1) {
+		return 0, fmt.Errorf("xmss: tree cache for %s would be too large", params.name)
+	}
+	return total, nil
+}
+
+// offset returns the position in nodes of the node at the given height and
+// index in the tree with index tree on layer. The trees are stored layer by
+// layer, the nodes of a tree height by height.
+func (c *TreeCache) offset(layer uint32, tree uint64, height, index uint32) uint64 {
+	th := c.params.treeHeight
+	perTree := uint64(1)<<(th+1) - 1
+	var pos uint64
+	for i := uint32(0); i < layer; i++ {
+		pos += perTree << ((uint32(c.params.d) - 1 - i) * th)
+	}
+	pos += tree*perTree + uint64(1)<<(th+1) - uint64(1)<<(th+1-height) + uint64(index)
+	return pos * uint64(c.params.n)
+}
+
+func (c *TreeCache) node(layer uint32, tree uint64, height, index uint32) []byte {
+	off := c.offset(layer, tree, height, index)
+	return c.nodes[off : off+uint64(c.params.n)]
+}
+
+// NewTreeCache computes every node of every tree of prv in memory. This takes
+// as long as generating an XMSS key. The result is checked against the root
+// of prv.
+func NewTreeCache(prv *PrivateKey) (*TreeCache, error) {
+	params := prv.params
+	if len(prv.prv) != int(params.prvBytes) {
+		return nil, ErrInvalidPrivateKey
+	}
+	size, err := treeCacheNodes(params)
+	if err != nil {
+		return nil, err
+	}
+	n := uint32(params.n)
+	off := params.indexBytes
+	prvSeed := prv.prv[off : off+n]
+	c := &TreeCache{
+		params:  params,
+		root:    append([]byte(nil), prv.prv[off+3*n:off+4*n]...),
+		pubSeed: append([]byte(nil), prv.prv[off+2*n:off+3*n]...),
+		nodes:   make([]byte, size*uint64(n)),
+	}
+
+	hs := newHasher(params, prvSeed, c.pubSeed)
+	root := make([]byte, n)
+	th := params.treeHeight
+	for i := uint32(0); i < uint32(params.d); i++ {
+		for t := uint64(0); t < uint64(1)<<((uint32(params.d)-1-i)*th); t++ {
+			var subtreeA address
+			subtreeA.setLayerAddr(i)
+			subtreeA.setTreeAddr(t)
+			err := treeNodes(hs, root, subtreeA, func(height, index uint32, node []byte) {
+				copy(c.nodes[c.offset(i, t, height, index):], node)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !bytes.Equal(root, c.root) {
+		return nil, ErrTreeCacheMismatch
+	}
+	return c, nil
+}
+
+// OpenTreeCache memory-maps the tree cache of prv kept in the sidecar file at
+// path. If the file does not exist, the cache is computed from the seeds of
+// prv like NewTreeCache and written to path with permissions 0600 first. A
+// file that belongs to another key is rejected with ErrTreeCacheMismatch, a
+// damaged one with ErrTreeCacheCorrupt; removing it has the cache rebuilt.
+func OpenTreeCache(prv *PrivateKey, path string) (*TreeCache, error) {
+	c, err := openTreeCache(prv.params, path)
+	if os.IsNotExist(err) {
+		if c, err = NewTreeCache(prv); err != nil {
+			return nil, err
+		}
+		if err := c.writeFile(path); err != nil {
+			return nil, err
+		}
+		c, err = openTreeCache(prv.params, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !c.belongsTo(prv) {
+		c.Close()
+		return nil, ErrTreeCacheMismatch
+	}
+	return c, nil
+}
+
+// header returns the header of a tree cache file,
+// [magic || name length || name || root || pubSeed || SHA-256 of the nodes]
+func (c *TreeCache) header(digest []byte) []byte {
+	hdr := append([]byte(nil), treeCacheMagic...)
+	hdr = append(hdr, byte(len(c.params.name)))
+	hdr = append(hdr, c.params.name...)
+	hdr = append(hdr, c.root...)
+	hdr = append(hdr, c.pubSeed...)
+	return append(hdr, digest...)
+}
+
+// writeFile durably writes the cache to path
+func (c *TreeCache) writeFile(path string) error {
+	digest := sha256.Sum256(c.nodes)
+	return writeFileAtomic(path, c.header(digest[:]), c.nodes)
+}
+
+// openTreeCache maps the cache file at path and checks that it is intact
+func openTreeCache(params *Params, path string) (*TreeCache, error) {
+	size, err := treeCacheNodes(params)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	n := uint64(params.n)
+	hdrLen := uint64(len(treeCacheMagic)+1+len(params.name)) + 2*n + sha256.Size
+	if uint64(info.Size()) != hdrLen+size*n {
+		return nil, ErrTreeCacheCorrupt
+	}
+	data, unmap, err := mapFile(f, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &TreeCache{params: params, nodes: data[hdrLen:], unmap: unmap}
+	off := uint64(len(treeCacheMagic) + 1 + len(params.name))
+	c.root = append([]byte(nil), data[off:off+n]...)
+	c.pubSeed = append([]byte(nil), data[off+n:off+2*n]...)
+	digest := sha256.Sum256(c.nodes)
+	if !bytes.Equal(data[:hdrLen], c.header(digest[:])) {
+		c.Close()
+		return nil, ErrTreeCacheCorrupt
+	}
+	return c, nil
+}
+
+// belongsTo reports whether c is the cache of prv
+func (c *TreeCache) belongsTo(prv *PrivateKey) bool {
+	n := uint32(prv.params.n)
+	off := prv.params.indexBytes
+	return c.params.name == prv.params.name &&
+		len(prv.prv) == int(prv.params.prvBytes) &&
+		bytes.Equal(c.pubSeed, prv.prv[off+2*n:off+3*n]) &&
+		bytes.Equal(c.root, prv.prv[off+3*n:off+4*n])
+}
+
+// Close releases the memory mapping of a cache opened with OpenTreeCache.
+// The cache must not be used afterwards.
+func (c *TreeCache) Close() error {
+	c.nodes = nil
+	if c.unmap == nil {
+		return nil
+	}
+	unmap := c.unmap
+	c.unmap = nil
+	return unmap()
+}
+
+// authPaths writes the authentication path read from the cache for every
+// layer and the WOTS signature over the root of the tree below on every
+// layer above the bottom one to sm. Each path is checked against the root of
+// its tree, so that damaged nodes are never released.
+func (c *TreeCache) authPaths(hs *hasher, sm, pubRoot []byte, idx uint64) error {
+	params := hs.params
+	n := uint32(params.n)
+	th := params.treeHeight
+	root := make([]byte, n)
+	var otsA, nodeA address
+	otsA.setType(xmssAddrTypeOTS)
+	nodeA.setType(xmssAddrTypeHASHTREE)
+
+	for i := uint32(0); i < uint32(params.d); i++ {
+		idxLeaf := uint32(idx) & ((1 << th) - 1)
+		idx = idx >> th
+
+		// The bottom WOTS signature is over the message, see finish
+		if i > 0 {
+			otsA.setLayerAddr(i)
+			otsA.setTreeAddr(idx)
+			otsA.setOTSAddr(idxLeaf)
+			signOTS(hs, sm[:params.wotsSignLen], root, &otsA)
+			sm = sm[params.wotsSignLen:]
+		}
+
+		for h := uint32(0); h < th; h++ {
+			copy(sm[h*n:(h+1)*n], c.node(i, idx, h, (idxLeaf>>h)^1))
+		}
+
+		// The root of this subtree is signed on the next layer
+		nodeA.setLayerAddr(i)
+		nodeA.setTreeAddr(idx)
+		computeRoot(hs, root, c.node(i, idx, 0, idxLeaf), sm[:th*n], idxLeaf, &nodeA)
+		if subtle.ConstantTimeCompare(root, c.node(i, idx, th, 0)) == 0 {
+			return ErrTreeCacheCorrupt
+		}
+		sm = sm[th*n:]
+	}
+	if subtle.ConstantTimeCompare(root, c.root) == 0 {
+		return ErrTreeCacheCorrupt
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package xmss
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// testTreeCache signs at the given indices with a key using c and checks
+// every signature against the one computed without a cache
+func testTreeCache(t *testing.T, prv *PrivateKey, c *TreeCache, indices []int) {
+	if err := prv.SetTreeCache(c); err != nil {
+		t.Fatal(err)
+	}
+	m := []byte("tree cache test message")
+	for _, idx := range indices {
+		// The index is managed outside of the key
+		copy(prv.prv[:prv.params.indexBytes], toByte(idx, int(prv.params.indexBytes)))
+		legacy := make(PrivateXMSS, len(prv.prv))
+		copy(legacy, prv.prv)
+		want, err := legacy.SignMessage(prv.params, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := prv.SignMessage(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("Signature at index %d differs from treehash", idx)
+		}
+	}
+}
+
+func TestTreeCache(t *testing.T) {
+	t.Parallel()
+	for _, hd := range [][2]int{{5, 1}, {4, 2}} {
+		params, err := NewParams(SHA2, 32, 16, hd[0], hd[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		seed := make([]byte, params.n)
+		prv, err := NewKeyFromSeeds(params, seed, seed, seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := NewTreeCache(prv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testTreeCache(t, prv, c, []int{0, 13, 7, 1<<uint(hd[0]) - 1})
+
+		// Damaged nodes are detected before a signature is released
+		c.node(0, 0, 1, 1)[0] ^= 1
+		copy(prv.prv[:params.indexBytes], toByte(0, int(params.indexBytes)))
+		if _, err := prv.SignMessage(nil); err != ErrTreeCacheCorrupt {
+			t.Errorf("Expected %v, got %v", ErrTreeCacheCorrupt, err)
+		}
+	}
+}
+
+func TestTreeCacheFile(t *testing.T) {
+	t.Parallel()
+	params, err := NewParams(SHA2, 32, 16, 4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "xmss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "key.tree")
+
+	seed := make([]byte, params.n)
+	prv, err := NewKeyFromSeeds(params, seed, seed, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A missing cache is built from the seeds
+	c, err := OpenTreeCache(prv, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Tree cache written with permissions %v", info.Mode().Perm())
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = OpenTreeCache(prv, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testTreeCache(t, prv, c, []int{3, 0, 15})
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := NewKeyFromSeeds(params, seed, seed, bytes.Repeat([]byte{1}, params.n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenTreeCache(other, path); err != ErrTreeCacheMismatch {
+		t.Errorf("Expected %v, got %v", ErrTreeCacheMismatch, err)
+	}
+	if err := other.SetTreeCache(c); err != ErrTreeCacheMismatch {
+		t.Errorf("Expected %v, got %v", ErrTreeCacheMismatch, err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 1
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenTreeCache(prv, path); err != ErrTreeCacheCorrupt {
+		t.Errorf("Expected %v, got %v", ErrTreeCacheCorrupt, err)
+	}
+}
@@ -23,6 +23,20 @@ func toByte(x, y int) (z []byte) {
 	return
 }
 
+// indexToByte is toByte for signature indices, which exceed the range of int
+// on 32-bit platforms for XMSS^MT
+func indexToByte(idx uint64, y int) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], idx)
+	z := make([]byte, y)
+	if y >= len(buf) {
+		copy(z[y-len(buf):], buf[:])
+	} else {
+		copy(z, buf[len(buf)-y:])
+	}
+	return z
+}
+
 func fromByte(x []byte, y int) (z uint64) {
 	z = 0
 
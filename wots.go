@@ -1,15 +1,14 @@
 package xmss
 
 // Expands an n-byte array into a len*n byte array using the `prf` function
-func expandSeed(params *Params, inseed []byte) (expanded []byte) {
+func expandSeed(hs *hasher, inseed []byte) (expanded []byte) {
+	params := hs.params
 	expanded = make([]byte, params.wotsSignLen)
 
-	ctr := make([]byte, 32)
 	var idx int
 	for i := 0; i < int(params.wlen); i++ {
-		ctr = toByte(i, 32)
 		idx = i * params.n
-		hashPRF(params, expanded[idx:idx+params.n], inseed, ctr)
+		hs.prfSeed(expanded[idx:idx+params.n], inseed, uint32(i))
 	}
 	return
 }
@@ -28,19 +27,35 @@ func basew(params *Params, x, output []byte) {
 			bits += 8
 		}
 		bits -= params.log2w
-		output[out] = uint8(total>>bits) & (uint8(params.w) - 1)
+		output[out] = uint8((total >> bits) & uint(params.w-1))
 		out++
 	}
 }
 
 // Section 3.1.2. Algorithm 2: chain - Chaining Function
 // out and in have to be n-byte arrays, a is the address of the chain
-func chain(params *Params, out, in, seed []byte, start, steps uint32, a *address) {
+func chain(hs *hasher, out, in []byte, start, steps uint32, a *address) {
 	copy(out, in)
 
 	for i := start; i < (start + steps); i++ {
 		a.setHashAddr(i)
-		hashF(params, out, seed, out, a)
+		hs.hashF(out, out, a)
+	}
+}
+
+// chains computes the chain function for the wlen chains of a WOTS key,
+// chain i from in[i*n:] to out[i*n:] starting at start[i] for steps[i]
+// steps. For SHA-256 with n = 32 the chains are hashed on the lanes of
+// hs.lanes, the others one after another. Only the OTS address of a is used.
+func chains(hs *hasher, out, in []byte, start, steps []uint32, a *address) {
+	if hs.lanes != nil {
+		hs.lanes.chains(out, in, start, steps, a)
+		return
+	}
+	n := hs.params.n
+	for i := range start {
+		a.setChainAddr(uint32(i))
+		chain(hs, out[i*n:(i+1)*n], in[i*n:(i+1)*n], start[i], steps[i], a)
 	}
 }
 
@@ -50,12 +65,16 @@ func chain(params *Params, out, in, seed []byte, start, steps uint32, a *address
 func wotsChecksum(params *Params, lengths, in []byte) {
 	basew(params, in, lengths[:params.len1])
 
-	var csum uint16
+	var csum uint64
 	for i := 0; i < int(params.len1); i++ {
-		csum += uint16(params.w) - 1 - uint16(lengths[i])
+		csum += uint64(params.w) - 1 - uint64(lengths[i])
 	}
-	csum <<= 4
-	csumBytes := toByte(int(csum), int(params.len2*uint32(params.log2w)+7)/8)
+	// Left-align the len2 base-w digits of the checksum in whole bytes. The
+	// outer modulo keeps w = 256 from shifting the top byte out, which the
+	// literal RFC 8391 formula would do.
+	csumBits := params.len2 * uint32(params.log2w)
+	csum <<= (8 - csumBits%8) % 8
+	csumBytes := toByte(int(csum), int(csumBits+7)/8)
 	basew(params, csumBytes, lengths[params.len1:])
 }
 
@@ -64,27 +83,44 @@ type publicWOTS []byte
 type signatureWOTS []byte
 
 // Section 3.1.3. Algorithm 3: WOTS_genSK - Generating a WOTS+ Private Key
-func generatePrivate(params *Params, seed []byte) *privateWOTS {
+func generatePrivate(hs *hasher, a *address) *privateWOTS {
+	params := hs.params
 	var prv privateWOTS
-	prv = expandSeed(params, seed)
+	if params.keygen == KeyDerivationSP800208 {
+		// PRF_keygen(SK_SEED, PUB_SEED || ADRS) for every chain (NIST SP
+		// 800-208, Section 5.1)
+		prv = make([]byte, params.wotsSignLen)
+		a.setHashAddr(0)
+		a.setKeyAndMask(0)
+		for i := 0; i < int(params.wlen); i++ {
+			a.setChainAddr(uint32(i))
+			hs.prfAddr(prv[i*params.n:(i+1)*params.n], hs.keygenState, a)
+		}
+		return &prv
+	}
+	seed := make([]byte, params.n)
+	getSeed(hs, seed, a)
+	prv = expandSeed(hs, seed)
 	return &prv
 }
 
 // Section 3.1.4. Algorithm 4: WOTS_genPK - Generating a WOTS+ Public Key From a Private Key
 // WOTS key generation. Takes a 32 byte seed for the private key, expands it to
 // a full WOTS private key and computes the corresponding public key.
-// It requires the seed pubSeed (used to generate bitmasks and hash keys)
+// It requires the seed pubSeed of hs (used to generate bitmasks and hash keys)
 // and the address of this WOTS key pair.
-func (prv privateWOTS) generatePublic(params *Params, pubSeed []byte, a *address) *publicWOTS {
+func (prv privateWOTS) generatePublic(hs *hasher, a *address) *publicWOTS {
+	params := hs.params
 	var pub publicWOTS
 	// prv is wotsSignLen(wlen*n)-byte array
 	pub = make([]byte, len(prv))
 
-	for i := uint32(0); i < params.wlen; i++ {
-		a.setChainAddr(i)
-		idx := int(i) * params.n
-		chain(params, pub[idx:idx+params.n], prv[idx:idx+params.n], pubSeed, 0, uint32(params.w)-1, a)
+	start := make([]uint32, params.wlen)
+	steps := make([]uint32, params.wlen)
+	for i := range steps {
+		steps[i] = uint32(params.w) - 1
 	}
+	chains(hs, pub, prv, start, steps, a)
 
 	return &pub
 }
@@ -92,37 +128,41 @@ func (prv privateWOTS) generatePublic(params *Params, pubSeed []byte, a *address
 // Section 3.1.5. Algorithm 5: WOTS_sign - Generating a signature from a private key and a message
 // Takes a n-byte message and the 32-byte seed for the private key to compute a
 // signature that is placed at 'sig'.
-func (prv privateWOTS) sign(params *Params, in, pubSeed []byte, a *address) *signatureWOTS {
+func (prv privateWOTS) sign(hs *hasher, in []byte, a *address) *signatureWOTS {
+	params := hs.params
 	lengths := make([]byte, params.wlen)
 	wotsChecksum(params, lengths, in)
 
 	var sign signatureWOTS
 	sign = make([]byte, len(prv))
-	copy(sign, prv)
 
-	for i := uint32(0); i < params.wlen; i++ {
-		a.setChainAddr(i)
-		idx := int(i) * params.n
-		chain(params, sign[idx:idx+params.n], sign[idx:idx+params.n], pubSeed, 0, uint32(lengths[i]), a)
+	start := make([]uint32, params.wlen)
+	steps := make([]uint32, params.wlen)
+	for i := range steps {
+		steps[i] = uint32(lengths[i])
 	}
+	chains(hs, sign, prv, start, steps, a)
 
 	return &sign
 }
 
 // Section 3.1.6. Algorithm 6: WOTS_pkFromSig - Computing a WOTS+ public key from a message and its signature
 // Takes a WOTS signature and an n-byte message, computes a WOTS public key.
-func (sign signatureWOTS) getPublic(params *Params, in, pubSeed []byte, a *address) *publicWOTS {
+func (sign signatureWOTS) getPublic(hs *hasher, in []byte, a *address) *publicWOTS {
+	params := hs.params
 	lengths := make([]byte, params.wlen)
 	wotsChecksum(params, lengths, in)
 
 	var pub publicWOTS
 	pub = make([]byte, params.wotsSignLen)
 
-	for i := uint32(0); i < params.wlen; i++ {
-		a.setChainAddr(i)
-		idx := int(i) * params.n
-		chain(params, pub[idx:idx+params.n], sign[idx:idx+params.n], pubSeed, uint32(lengths[i]), uint32(params.w)-1-uint32(lengths[i]), a)
+	start := make([]uint32, params.wlen)
+	steps := make([]uint32, params.wlen)
+	for i := range start {
+		start[i] = uint32(lengths[i])
+		steps[i] = uint32(params.w) - 1 - start[i]
 	}
+	chains(hs, pub, sign, start, steps, a)
 
 	return &pub
 }
@@ -18,7 +18,21 @@ func (a *address) initRandom() {
 func TestWOTS(t *testing.T) {
 	t.Parallel()
 	// For WOTS+ tests, the parameter set doesn't matter since n, w and wlen are identical
-	params := SHA2_10_256
+	testWOTS(t, SHA2_10_256)
+}
+
+func TestWOTSWinternitz(t *testing.T) {
+	t.Parallel()
+	for _, w := range []int{4, 256} {
+		params, err := NewParams(SHA2, 32, w, 10, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testWOTS(t, params)
+	}
+}
+
+func testWOTS(t *testing.T, params *Params) {
 	seed := make([]byte, params.n)
 	rand.Read(seed)
 	pubSeed := make([]byte, params.n)
@@ -29,13 +43,69 @@ func TestWOTS(t *testing.T) {
 	var a address
 	a.initRandom()
 
-	prv := *generatePrivate(params, seed)
-	pub1 := *prv.generatePublic(params, pubSeed, &a)
-	sign := *prv.sign(params, m, pubSeed, &a)
-	pub2 := *sign.getPublic(params, m, pubSeed, &a)
+	hs := newHasher(params, seed, pubSeed)
+	prv := *generatePrivate(hs, &a)
+	pub1 := *prv.generatePublic(hs, &a)
+	sign := *prv.sign(hs, m, &a)
+	pub2 := *sign.getPublic(hs, m, &a)
 
 	if !bytes.Equal(pub1, pub2) {
 		t.Error("WOTS+ test failed. Public keys do not match")
 	}
 
 }
+
+// TestKeyDerivation checks the WOTS+ private keys against PRF and PRF_keygen
+// written out with a plain hash function
+func TestKeyDerivation(t *testing.T) {
+	t.Parallel()
+	for _, v := range []struct {
+		hash HashFunc
+		n    int
+	}{{SHA2, 24}, {SHA2, 32}, {SHAKE256, 32}} {
+		for _, kd := range []KeyDerivation{KeyDerivationLegacy, KeyDerivationSP800208} {
+			params, err := NewParams(v.hash, v.n, 16, 4, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if params, err = params.WithKeyDerivation(kd); err != nil {
+				t.Fatal(err)
+			}
+			n := params.n
+			prvSeed := bytes.Repeat([]byte{5}, n)
+			pubSeed := bytes.Repeat([]byte{6}, n)
+			prf := func(parts ...[]byte) []byte {
+				h := newHash(params)
+				for _, p := range parts {
+					h.Write(p)
+				}
+				return h.Sum(nil)[:n]
+			}
+			var a address
+			a.initRandom()
+			a.setType(xmssAddrTypeOTS)
+			a.setChainAddr(0)
+			a.setHashAddr(0)
+			a.setKeyAndMask(0)
+			addr := make([]byte, 32)
+			a.toByte(addr)
+			seed := prf(toByte(domainPRF, params.paddingLen), prvSeed, addr)
+
+			var want []byte
+			for i := 0; i < params.Len(); i++ {
+				if kd == KeyDerivationLegacy {
+					want = append(want, prf(toByte(domainPRF, params.paddingLen), seed, toByte(i, 32))...)
+					continue
+				}
+				a.setChainAddr(uint32(i))
+				a.toByte(addr)
+				want = append(want, prf(toByte(domainKeygen, params.paddingLen), prvSeed, pubSeed, addr)...)
+			}
+			a.setChainAddr(0)
+			hs := newHasher(params, prvSeed, pubSeed)
+			if got := *generatePrivate(hs, &a); !bytes.Equal(got, want) {
+				t.Errorf("%s: %v key derivation differs from the specification", params.Name(), kd)
+			}
+		}
+	}
+}
@@ -1,14 +1,19 @@
 package xmss
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/subtle"
+	"fmt"
+	"io"
 )
 
 // Section 4.1.5. Algorithm 8: ltree
 // Computes a leaf node from a WOTS public key using an L-tree.
 // Note that this destroys the used WOTS public key.
-func lTree(params *Params, leaf, seed []byte, wotsPub publicWOTS, a *address) {
+func lTree(hs *hasher, leaf []byte, wotsPub publicWOTS, a *address) {
+	params := hs.params
 	l := params.wlen
 	var parentNodes uint32
 	height := uint32(0)
@@ -23,7 +28,7 @@ func lTree(params *Params, leaf, seed []byte, wotsPub publicWOTS, a *address) {
 			a.setTreeIndex(i)
 			idxOut = i * n
 			idxIn = i * 2 * n
-			hashH(params, wotsPub[idxOut:idxOut+n], seed, wotsPub[idxIn:idxIn+2*n], a)
+			hs.hashH(wotsPub[idxOut:idxOut+n], wotsPub[idxIn:idxIn+2*n], a)
 		}
 
 		// If the row contained an odd number of nodes, the last node was not
@@ -45,7 +50,8 @@ func lTree(params *Params, leaf, seed []byte, wotsPub publicWOTS, a *address) {
 
 // Section 4.1.10. Algorithm 13: XMSS_rootFromSig - Compute a root node from a tree signature
 // Computes a root node given a leaf and an auth path
-func computeRoot(params *Params, root, leaf, authPath, pubSeed []byte, leafIdx uint32, a *address) {
+func computeRoot(hs *hasher, root, leaf, authPath []byte, leafIdx uint32, a *address) {
+	params := hs.params
 	n := params.n
 	buf := make([]byte, 2*n)
 
@@ -67,10 +73,10 @@ func computeRoot(params *Params, root, leaf, authPath, pubSeed []byte, leafIdx u
 
 		// Pick the right or left neighbor, depending on parity of the node.
 		if leafIdx&1 == 1 {
-			hashH(params, buf[n:], pubSeed, buf, a)
+			hs.hashH(buf[n:], buf, a)
 			copy(buf[:n], authPath[:n])
 		} else {
-			hashH(params, buf[:n], pubSeed, buf, a)
+			hs.hashH(buf[:n], buf, a)
 			copy(buf[n:], authPath[:n])
 		}
 
@@ -80,43 +86,93 @@ func computeRoot(params *Params, root, leaf, authPath, pubSeed []byte, leafIdx u
 	a.setTreeHeight(params.treeHeight - 1)
 	leafIdx >>= 1
 	a.setTreeIndex(leafIdx)
-	hashH(params, root, pubSeed, buf, a)
+	hs.hashH(root, buf, a)
 }
 
-// Used for pseudo-random key generation.
+// Used for pseudo-random key generation with KeyDerivationLegacy.
 // Generates the seed for the WOTS key pair at address a
-// Takes n-byte prvSeed and returns n-byte seed using 32 byte address a
-func getSeed(params *Params, seed, prvSeed []byte, a *address) {
+// Takes the n-byte prvSeed of hs and returns n-byte seed using 32 byte address a
+func getSeed(hs *hasher, seed []byte, a *address) {
 	a.setChainAddr(0)
 	a.setHashAddr(0)
 	a.setKeyAndMask(0)
 
-	bytes := a.toByte()
-	hashPRF(params, seed, prvSeed, bytes)
+	hs.prfAddr(seed, hs.prvState, a)
 }
 
 // Computes the leaf at a given address. First generates the WOTS key pair,
 // then computes leaf using lTree. As this happens position independent, we
 // only require that address encodes the right ltree-address.
-func generateLeafWOTS(params *Params, leaf, prvSeed, pubSeed []byte, ltreeA, otsA *address) {
-	seed := make([]byte, params.n)
+func generateLeafWOTS(hs *hasher, leaf []byte, ltreeA, otsA *address) {
+	prv := *generatePrivate(hs, otsA)
+	pub := *prv.generatePublic(hs, otsA)
 
-	getSeed(params, seed, prvSeed, otsA)
-	prv := *generatePrivate(params, seed)
-	pub := *prv.generatePublic(params, pubSeed, otsA)
-
-	lTree(params, leaf, pubSeed, pub, ltreeA)
+	lTree(hs, leaf, pub, ltreeA)
 }
 
 // Section 4.1.6. Algorithm 9: treeHash
 // For a given leaf index, computes the authentication path and the resulting
 // root node using Merkle's TreeHash algorithm.
 // Expects the layer and tree parts of subtree_addr to be set.
-func treehash(params *Params, root, authPath, prvSeed, pubSeed []byte, leafIdx uint32, subtreeA address) {
-	stack := make([]byte, int(params.treeHeight+1)*params.n)
-	heights := make([]uint32, params.treeHeight+1)
-	offset := uint32(0)
+func treehash(hs *hasher, root, authPath []byte, leafIdx uint32, subtreeA address) error {
+	params := hs.params
 	n := uint32(params.n)
+	return treeNodes(hs, root, subtreeA, func(height, index uint32, node []byte) {
+		// If this is a node we need for the auth path..
+		if height < params.treeHeight && ((leafIdx>>height)^1) == index {
+			copy(authPath[height*n:(height+1)*n], node)
+		}
+	})
+}
+
+// treeNodes computes all nodes of a subtree with Merkle's TreeHash algorithm
+// and writes its root to root. visit is called with every node as soon as it
+// is computed, leaves included, together with its height and its index
+// within that height. node must not be retained.
+// Expects the layer and tree parts of subtree_addr to be set.
+// The context of hs.prog is checked before every leaf, once it is done its
+// error is returned and root is not set.
+func treeNodes(hs *hasher, root []byte, subtreeA address, visit func(height, index uint32, node []byte)) error {
+	return rangeNodes(hs, root, subtreeA, 0, hs.params.treeHeight, visit)
+}
+
+// rangeNodes is treeNodes for the part of the subtree of the given height
+// whose leftmost leaf is start. start must be a multiple of 2^height.
+func rangeNodes(hs *hasher, root []byte, subtreeA address, start, height uint32, visit func(height, index uint32, node []byte)) error {
+	st := newTreeHashState(hs.params, start, height)
+	if err := st.run(hs, subtreeA, start+1<<height, visit, nil); err != nil {
+		return err
+	}
+	copy(root, st.stack[:hs.params.n])
+	return nil
+}
+
+// treeHashState is the state of Merkle's TreeHash algorithm between two
+// leaves: the stack of nodes that have no sibling yet, their heights and the
+// next leaf
+type treeHashState struct {
+	stack   []byte
+	heights []uint32
+	offset  uint32
+	next    uint32
+}
+
+// newTreeHashState returns the state before leaf start of a tree of the
+// given height
+func newTreeHashState(params *Params, start, height uint32) *treeHashState {
+	return &treeHashState{
+		stack:   make([]byte, int(height+1)*params.n),
+		heights: make([]uint32, height+1),
+		next:    start,
+	}
+}
+
+// run computes the leaves from st.next up to end and merges the nodes on the
+// stack. Once the whole tree is done, its root is at the bottom of the
+// stack. after is called after every leaf, it may be nil.
+func (st *treeHashState) run(hs *hasher, subtreeA address, end uint32, visit func(height, index uint32, node []byte), after func() error) error {
+	n := uint32(hs.params.n)
+	stack, heights := st.stack, st.heights
 
 	var otsA, ltreeA, nodeA address
 	var treeIdx uint32
@@ -129,17 +185,18 @@ func treehash(params *Params, root, authPath, prvSeed, pubSeed []byte, leafIdx u
 	ltreeA.setType(xmssAddrTypeLTREE)
 	nodeA.setType(xmssAddrTypeHASHTREE)
 
-	for i := uint32(0); i < uint32(1<<params.treeHeight); i++ {
+	for st.next < end {
+		if err := hs.prog.err(); err != nil {
+			return err
+		}
+		i, offset := st.next, st.offset
 		// Add the next leaf node to the stack.
 		ltreeA.setLTreeAddr(i)
 		otsA.setOTSAddr(i)
-		generateLeafWOTS(params, stack[offset*n:offset*n+n], prvSeed, pubSeed, &ltreeA, &otsA)
+		generateLeafWOTS(hs, stack[offset*n:offset*n+n], &ltreeA, &otsA)
+		hs.prog.leafDone()
 		heights[offset] = 0
-
-		// If this is a node we need for the auth path..
-		if (leafIdx ^ 1) == i {
-			copy(authPath[:n], stack[offset*n:offset*n+n])
-		}
+		visit(0, i, stack[offset*n:offset*n+n])
 		offset++
 
 		// While the top-most nodes are of equal height..
@@ -154,21 +211,22 @@ func treehash(params *Params, root, authPath, prvSeed, pubSeed []byte, leafIdx u
 			nodeA.setTreeHeight(heights[offset-1])
 			nodeA.setTreeIndex(treeIdx)
 			stackIdx := (offset - 2) * n
-			hashH(params, stack[stackIdx:stackIdx+n], pubSeed, stack[stackIdx:stackIdx+2*n], &nodeA)
+			hs.hashH(stack[stackIdx:stackIdx+n], stack[stackIdx:stackIdx+2*n], &nodeA)
 
 			offset--
 			// Note that the top-most node is now one layer higher
 			heights[offset-1]++
+			visit(heights[offset-1], treeIdx, stack[stackIdx:stackIdx+n])
+		}
+		st.next, st.offset = i+1, offset
 
-			if ((leafIdx >> heights[offset-1]) ^ 1) == treeIdx {
-				authIdx := heights[offset-1] * n
-				stackIdx = (offset - 1) * n
-				copy(authPath[authIdx:authIdx+n], stack[stackIdx:stackIdx+n])
+		if after != nil {
+			if err := after(); err != nil {
+				return err
 			}
 		}
 	}
-
-	copy(root, stack[:n])
+	return nil
 }
 
 // PrivateXMSS key
@@ -184,45 +242,150 @@ type SignatureXMSS []byte
 // Generates a XMSS key pair for a given parameter set.
 // Format private: [(32bit) index || prvSeed || seed || pubSeed || root]
 // Format public: [root || pubSeed]
+// The reference implementation swaps root and pubSeed in the private key, use
+// ExportPrivateKey and ImportPrivateKey to convert between the two.
+// It panics if the system's secure random number generator fails, use
+// GenerateKey to handle the error instead.
 func GenerateXMSSKeypair(params *Params) (*PrivateXMSS, *PublicXMSS) {
-	var prv PrivateXMSS
-	var pub PublicXMSS
-	prv = make([]byte, params.prvBytes)
-	pub = make([]byte, params.pubBytes)
-	n := uint32(params.n)
+	prv, err := GenerateKey(params, rand.Reader)
+	if err != nil {
+		// Never hand out a key derived from incomplete randomness
+		panic(err)
+	}
+	pub := prv.PublicKey().pub
+	return &prv.prv, &pub
+}
+
+// GenerateKey generates a key pair for a given parameter set, reading the
+// 3n bytes of prvSeed, prfSeed and pubSeed (in this order) from random. The
+// same input always yields the same key.
+func GenerateKey(params *Params, random io.Reader) (*PrivateKey, error) {
+	return GenerateKeyParallel(params, random, 1)
+}
+
+// GenerateKeyParallel is GenerateKey with the tree computed by workers
+// goroutines. The key is identical to the one GenerateKey returns for the
+// same input. workers < 1 uses runtime.GOMAXPROCS(0) goroutines.
+func GenerateKeyParallel(params *Params, random io.Reader, workers int) (*PrivateKey, error) {
+	return GenerateKeyContext(context.Background(), params, random, workers, nil)
+}
+
+// GenerateKeyContext is GenerateKeyParallel that can be cancelled through
+// ctx and reports the leaves of the top-most tree computed so far to
+// progress, which may be nil. Once ctx is done its error is returned, the
+// tree is abandoned within one leaf per goroutine.
+func GenerateKeyContext(ctx context.Context, params *Params, random io.Reader, workers int, progress Progress) (*PrivateKey, error) {
+	n := params.n
+	seeds := make([]byte, 3*n)
+	if _, err := io.ReadFull(random, seeds); err != nil {
+		return nil, ErrEntropy
+	}
+	return NewKeyFromSeedsContext(ctx, params, seeds[:n], seeds[n:2*n], seeds[2*n:], workers, progress)
+}
 
-	// We do not need the auth path in key generation, but it simplifies the
-	// code to have just one treehash routine that computes both root and path
-	// in one function
-	authPath := make([]byte, params.treeHeight*n)
+// NewKeyFromSeeds computes the key pair for the given n-byte SK_SEED (prvSeed),
+// SK_PRF (prfSeed) and PUB_SEED (pubSeed), e.g. to recover a key from a
+// backed up seed. The returned key starts at index 0.
+func NewKeyFromSeeds(params *Params, prvSeed, prfSeed, pubSeed []byte) (*PrivateKey, error) {
+	return NewKeyFromSeedsParallel(params, prvSeed, prfSeed, pubSeed, 1)
+}
+
+// NewKeyFromSeedsParallel is NewKeyFromSeeds with the tree computed by
+// workers goroutines, see GenerateKeyParallel
+func NewKeyFromSeedsParallel(params *Params, prvSeed, prfSeed, pubSeed []byte, workers int) (*PrivateKey, error) {
+	return NewKeyFromSeedsContext(context.Background(), params, prvSeed, prfSeed, pubSeed, workers, nil)
+}
+
+// NewKeyFromSeedsContext is NewKeyFromSeedsParallel that can be cancelled
+// through ctx and reports its progress, see GenerateKeyContext
+func NewKeyFromSeedsContext(ctx context.Context, params *Params, prvSeed, prfSeed, pubSeed []byte, workers int, progress Progress) (*PrivateKey, error) {
+	n := uint32(params.n)
+	if len(prvSeed) != int(n) || len(prfSeed) != int(n) || len(pubSeed) != int(n) {
+		return nil, fmt.Errorf("xmss: seeds must be %d bytes long for %s", n, params.name)
+	}
+	prv := make(PrivateXMSS, params.prvBytes)
+	root := make([]byte, n)
 	var topTreeA address
 
 	topTreeA.setLayerAddr(uint32(params.d) - 1)
-	copy(prv[:params.indexBytes], make([]byte, params.indexBytes))
-	// Initialize prvSeed, prfSeed and pubSeed
-	rand.Read(prv[params.indexBytes : params.indexBytes+3*n])
-	copy(pub[n:2*n], prv[params.indexBytes+2*n:params.indexBytes+3*n])
-
-	// Compute root node of the top-most subtree
-	treehash(params, pub, authPath, prv[params.indexBytes:params.indexBytes+n], pub[n:2*n], 0, topTreeA)
-	copy(prv[params.indexBytes+3*n:], pub[:n])
+	copy(prv[params.indexBytes:], prvSeed)
+	copy(prv[params.indexBytes+n:], prfSeed)
+	copy(prv[params.indexBytes+2*n:], pubSeed)
+
+	hs := newHasher(params, prvSeed, pubSeed)
+	hs.prog = newProgress(ctx, progress)
+	hs.prog.expect(1 << params.treeHeight)
+	key := &PrivateKey{params: params, prv: prv}
+	if params.d == 1 {
+		// The top-most subtree is the only one, so the pass that computes
+		// its root also sets up the traversal state for the first signature
+		key.trav, _ = newTraversal(params, defaultBDSK(params))
+		if err := key.trav.layers[0].build(hs, root, 0, topTreeA, workers); err != nil {
+			return nil, err
+		}
+		key.trav.ready = true
+	} else {
+		// Compute root node of the top-most subtree
+		if err := treeNodesParallel(hs, root, topTreeA, workers, func(height, index uint32, node []byte) {}); err != nil {
+			return nil, err
+		}
+	}
+	copy(prv[params.indexBytes+3*n:], root)
 
-	return &prv, &pub
+	return key, nil
 }
 
 // Verify Section 4.1.10. Algorithm 14: XMSS_verify - Verify an XMSS signature using the corresponding XMSS public key and a message
 // Verifies a given message signature pair under a given public key.
-// Note that this assumes a pk without an OID, i.e. [root || pubSeed]
+// Note that this assumes a pk without an OID, i.e. [root || pubSeed]. Keys with
+// an OID are decoded by ParsePublicKey and ParsePublicKeyMT.
+// Malformed input is reported as a mismatch, see VerifyMessage for the cause.
 func Verify(params *Params, m, signature []byte, pub PublicXMSS) (match bool) {
+	return VerifyMessage(params, m, signature, pub) == nil
+}
+
+// VerifyMessage verifies an attached signature like Verify, but reports why
+// verification failed. m must have the length of signature, on success the
+// message is placed at m[params.SignBytes():], otherwise that part is zeroed.
+// All lengths are checked against params before the input is processed.
+func VerifyMessage(params *Params, m, signature []byte, pub PublicXMSS) error {
+	if len(pub) != int(params.pubBytes) {
+		return ErrInvalidPublicKey
+	}
+	if len(signature) < int(params.signBytes) {
+		return ErrInvalidSignatureLength
+	}
+	if len(m) != len(signature) {
+		return ErrInvalidMessageBuffer
+	}
+
+	msg := signature[params.signBytes:]
+	if err := verifyDetached(params, msg, signature[:params.signBytes], pub); err != nil {
+		// Zero the message
+		copy(m[params.signBytes:], make([]byte, len(msg)))
+		return err
+	}
+	copy(m[params.signBytes:], msg)
+	return nil
+}
+
+// verifyDetached checks a signature of exactly params.signBytes bytes over m.
+// The length of pub and signature must have been checked by the caller.
+func verifyDetached(params *Params, m, signature []byte, pub PublicXMSS) error {
+	return verifyReader(params, bytes.NewReader(m), signature, pub)
+}
+
+// verifyReader checks a signature of exactly params.signBytes bytes over the
+// message read from r. The length of pub and signature must have been checked
+// by the caller.
+func verifyReader(params *Params, r io.Reader, signature []byte, pub PublicXMSS) error {
 	n := uint32(params.n)
 	pubRoot := pub[:n]
-	pubSeed := pub[n:]
+	hs := newHasher(params, nil, pub[n:])
 	var wotsSign signatureWOTS
 	var wotsPub publicWOTS
 	leaf := make([]byte, n)
 	root := make([]byte, n)
-	msgHash := make([]byte, n)
-	msgLen := len(signature) - int(params.signBytes)
 
 	var otsA, ltreeA, nodeA address
 	otsA.setType(xmssAddrTypeOTS)
@@ -231,9 +394,11 @@ func Verify(params *Params, m, signature []byte, pub PublicXMSS) (match bool) {
 
 	idx := fromByte(signature[:params.indexBytes], int(params.indexBytes))
 
-	copy(m[params.signBytes:], signature[params.signBytes:])
-	hashMsg(params, msgHash, signature[params.indexBytes:params.indexBytes+n], pubRoot, m[params.signBytes-4*n:], idx)
-	copy(root, msgHash)
+	h := newMsgHash(params, signature[params.indexBytes:params.indexBytes+n], pubRoot, idx)
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	copy(root, h.Sum(nil))
 
 	signature = signature[params.indexBytes+n:]
 
@@ -255,37 +420,106 @@ func Verify(params *Params, m, signature []byte, pub PublicXMSS) (match bool) {
 		wotsSign = signature[:params.wotsSignLen]
 		// Initially, root = mhash, but on subsequent iterations it is the root
 		// of the subtree below the currently processed subtree.
-		wotsPub = *wotsSign.getPublic(params, root, pubSeed, &otsA)
+		wotsPub = *wotsSign.getPublic(hs, root, &otsA)
 		signature = signature[params.wotsSignLen:]
 
 		// Compute the leaf node using the WOTS public key
 		ltreeA.setLTreeAddr(idxLeaf)
-		lTree(params, leaf, pubSeed, wotsPub, &ltreeA)
+		lTree(hs, leaf, wotsPub, &ltreeA)
 
 		// Compute the root node of this subtree
-		computeRoot(params, root, leaf, signature[:params.treeHeight*n], pubSeed, idxLeaf, &nodeA)
+		computeRoot(hs, root, leaf, signature[:params.treeHeight*n], idxLeaf, &nodeA)
 		signature = signature[params.treeHeight*n:]
 	}
 
 	// Check if the root node equals the root node in the public key
 	if subtle.ConstantTimeCompare(root, pubRoot) == 0 {
-		// Zero the message
-		copy(m[params.signBytes:], make([]byte, msgLen))
-		match = false
-	} else {
-		copy(m[params.signBytes:], signature)
-		match = true
+		return ErrInvalidSignature
 	}
-	return
+	return nil
 }
 
 // Sign Section 4.1.9. Algorithm 12: XMSS_sign - Generate an XMSS signature and update the XMSS private key
 // Signs a message. Returns an array containing the signature followed by the
 // message and an updated secret key.
+// Returns nil if the message cannot be signed, see SignMessage for the cause.
 func (prv PrivateXMSS) Sign(params *Params, m []byte) *SignatureXMSS {
+	signature, err := prv.SignMessage(params, m)
+	if err != nil {
+		return nil
+	}
+	return &signature
+}
+
+// Index returns the index of the next one-time key prv signs with, which is
+// params.MaxSignatures() once prv is exhausted
+func (prv PrivateXMSS) Index(params *Params) uint64 {
+	idx := fromByte(prv[:params.indexBytes], int(params.indexBytes))
+	if max := params.MaxSignatures(); idx > max {
+		return max
+	}
+	return idx
+}
+
+// setIndex stores idx in prv. Once every one-time key is used, it stores an
+// index of all ones like the reference implementation, since 2^h does not
+// fit into the index of every parameter set.
+func (prv PrivateXMSS) setIndex(params *Params, idx uint64) {
+	if idx >= params.MaxSignatures() {
+		for i := range prv[:params.indexBytes] {
+			prv[i] = 0xff
+		}
+		return
+	}
+	copy(prv[:params.indexBytes], indexToByte(idx, int(params.indexBytes)))
+}
+
+// Remaining returns the number of signatures prv can still create
+func (prv PrivateXMSS) Remaining(params *Params) uint64 {
+	idx := prv.Index(params)
+	if idx >= params.MaxSignatures() {
+		return 0
+	}
+	return params.MaxSignatures() - idx
+}
+
+// SignMessage signs a message like Sign, but reports why signing failed.
+// Once all 2^h one-time keys are used it returns ErrKeyExhausted.
+func (prv PrivateXMSS) SignMessage(params *Params, m []byte) (SignatureXMSS, error) {
+	return prv.SignMessageContext(context.Background(), params, m, nil)
+}
+
+// SignMessageContext is SignMessage that can be cancelled through ctx and
+// reports the leaves computed so far to progress, which may be nil. Signing
+// with a PrivateXMSS computes every tree on the path to the root, d * 2^(h/d)
+// leaves. Once ctx is done its error is returned. The index of prv has
+// already been advanced then, the one-time key is never used.
+func (prv PrivateXMSS) SignMessageContext(ctx context.Context, params *Params, m []byte, progress Progress) (SignatureXMSS, error) {
 	var signature SignatureXMSS
 	signature = make([]byte, int(params.signBytes)+len(m))
+	copy(signature[params.signBytes:], m)
+	if err := prv.signReader(params, signature[:params.signBytes], bytes.NewReader(m), nil, newProgress(ctx, progress)); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
 
+// signReader writes the params.signBytes bytes signature over the message
+// read from r to signature and advances the index of prv. Without a
+// layerSigner s every layer is recomputed after the message is read, and if
+// reading fails the index is left unchanged. With s, the index is claimed
+// and the layers are signed by s first, see claim. prog may be nil.
+func (prv PrivateXMSS) signReader(params *Params, signature []byte, r io.Reader, s layerSigner, prog *progress) error {
+	if s != nil {
+		p, err := prv.claim(params, signature, s, prog)
+		if err != nil {
+			return err
+		}
+		return p.finish(r)
+	}
+	if len(prv) != int(params.prvBytes) {
+		return ErrInvalidPrivateKey
+	}
 	n := uint32(params.n)
 	prvSeed := prv[params.indexBytes : params.indexBytes+n]
 	prfSeed := prv[params.indexBytes+n : params.indexBytes+2*n]
@@ -293,32 +527,132 @@ func (prv PrivateXMSS) Sign(params *Params, m []byte) *SignatureXMSS {
 	pubRoot := prv[params.indexBytes+3*n : params.indexBytes+4*n]
 
 	root := make([]byte, n)
-	msgHash := make([]byte, n)
-	otsSeed := make([]byte, n)
-	var idxLeaf uint32
 
-	var otsA address
-	otsA.setType(xmssAddrTypeOTS)
+	idx := prv.Index(params)
+	// Never reuse a one-time key, even if the index has been set past the end
+	if idx >= params.MaxSignatures() {
+		return ErrKeyExhausted
+	}
+	copy(signature[:params.indexBytes], prv[:params.indexBytes])
 
-	// Already put the message in the right place, to make it easier to prepend
-	// things when computing the hash over the message
-	copy(signature[params.signBytes:], m)
+	// Compute the digest randomization value
+	hs := newHasher(params, prvSeed, pubSeed)
+	hs.prog = prog
+	idxBytes := indexToByte(idx, 32)
+	hs.prf(signature[params.indexBytes:params.indexBytes+n], prfSeed, idxBytes)
 
-	idx := fromByte(prv[:params.indexBytes], int(params.indexBytes))
-	copy(signature[:params.indexBytes], prv[:params.indexBytes])
+	// Compute the message hash
+	h := newMsgHash(params, signature[params.indexBytes:params.indexBytes+n], pubRoot, idx)
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	copy(root, h.Sum(nil))
 
 	// Increment the index in the private key
-	copy(prv[:params.indexBytes], toByte(int(idx+1), int(params.indexBytes)))
+	prv.setIndex(params, idx+1)
 
-	// Compute the digest randomization value
-	idxBytes := toByte(int(idx), 32)
-	hashPRF(params, signature[params.indexBytes:params.indexBytes+n], prfSeed, idxBytes)
+	// Each layer appends a WOTS signature and an authentication path
+	sm := signature[params.indexBytes+n:]
+	hs.prog.expect(uint64(params.d) << params.treeHeight)
+	if err := signLayers(hs, sm, root, idx, 0); err != nil {
+		return err
+	}
+	// A signature under another root would not verify, so it is not released
+	if subtle.ConstantTimeCompare(root, pubRoot) == 0 {
+		for i := range signature {
+			signature[i] = 0
+		}
+		return ErrRootMismatch
+	}
+	return nil
+}
 
-	// Compute the message hash
-	hashMsg(params, msgHash, signature[params.indexBytes:params.indexBytes+n], pubRoot, signature[params.signBytes-4*n:], idx)
-	copy(root, msgHash)
+// pendingSignature is a signature whose index is claimed and whose layers
+// are signed, all but the WOTS signature over the message on the bottom
+// layer. It no longer needs the key state, so it is finished without any
+// lock on the key.
+type pendingSignature struct {
+	hs        *hasher
+	signature []byte
+	prfSeed   []byte
+	pubRoot   []byte
+	idx       uint64
+}
 
-	for i := uint32(0); i < uint32(params.d); i++ {
+// claim advances the index of prv and lets s write the authentication path
+// of every layer and the WOTS signature of every layer above the bottom one
+// to signature. The message is signed by finish.
+func (prv PrivateXMSS) claim(params *Params, signature []byte, s layerSigner, prog *progress) (*pendingSignature, error) {
+	if len(prv) != int(params.prvBytes) {
+		return nil, ErrInvalidPrivateKey
+	}
+	n := uint32(params.n)
+	prvSeed := prv[params.indexBytes : params.indexBytes+n]
+	pubSeed := prv[params.indexBytes+2*n : params.indexBytes+3*n]
+
+	idx := prv.Index(params)
+	// Never reuse a one-time key, even if the index has been set past the end
+	if idx >= params.MaxSignatures() {
+		return nil, ErrKeyExhausted
+	}
+	copy(signature[:params.indexBytes], prv[:params.indexBytes])
+
+	hs := newHasher(params, prvSeed, pubSeed)
+	hs.prog = prog
+	p := &pendingSignature{
+		hs:        hs,
+		signature: signature,
+		prfSeed:   prv[params.indexBytes+n : params.indexBytes+2*n],
+		pubRoot:   prv[params.indexBytes+3*n : params.indexBytes+4*n],
+		idx:       idx,
+	}
+	sm := signature[params.indexBytes+n+params.wotsSignLen:]
+	if err := s.authPaths(hs, sm, p.pubRoot, idx); err != nil {
+		return nil, err
+	}
+	prv.setIndex(params, idx+1)
+	return p, nil
+}
+
+// finish computes R, hashes the message read from r and writes the WOTS
+// signature over its digest on the bottom layer. If reading fails, the
+// claimed one-time key is never used.
+func (p *pendingSignature) finish(r io.Reader) error {
+	params := p.hs.params
+	n := uint32(params.n)
+	rnd := p.signature[params.indexBytes : params.indexBytes+n]
+	p.hs.prf(rnd, p.prfSeed, indexToByte(p.idx, 32))
+
+	h := newMsgHash(params, rnd, p.pubRoot, p.idx)
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	otsA := otsAddress(params, 0, p.idx)
+	signOTS(p.hs, p.signature[params.indexBytes+n:params.indexBytes+n+params.wotsSignLen], h.Sum(nil)[:n], &otsA)
+	return nil
+}
+
+// layerSigner writes the part of a signature for index idx after the WOTS
+// signature of the bottom layer to sm: the authentication path of every
+// layer and the WOTS signature of every layer above the bottom one. pubRoot
+// is the root of the key.
+type layerSigner interface {
+	authPaths(hs *hasher, sm, pubRoot []byte, idx uint64) error
+}
+
+// signLayers writes the WOTS signature and the authentication path of every
+// layer from layer up to the top to sm, starting with a signature over root.
+// idx is the index within layer, i.e. the signature index shifted right by
+// layer tree heights. root is overwritten.
+func signLayers(hs *hasher, sm, root []byte, idx uint64, layer uint32) error {
+	params := hs.params
+	n := uint32(params.n)
+	var idxLeaf uint32
+
+	var otsA address
+	otsA.setType(xmssAddrTypeOTS)
+
+	for i := layer; i < uint32(params.d); i++ {
 		idxLeaf = uint32(idx) & ((1 << params.treeHeight) - 1)
 		idx = idx >> params.treeHeight
 
@@ -326,16 +660,23 @@ func (prv PrivateXMSS) Sign(params *Params, m []byte) *SignatureXMSS {
 		otsA.setTreeAddr(idx)
 		otsA.setOTSAddr(idxLeaf)
 
-		// Get a seed for the WOTS keypair
-		getSeed(params, otsSeed, prvSeed, &otsA)
+		// Sign the root of the layer below (initially the message hash)
+		signOTS(hs, sm[:params.wotsSignLen], root, &otsA)
+		sm = sm[params.wotsSignLen:]
 
-		wotsPrv := *generatePrivate(params, otsSeed)
-		wotsSign := *wotsPrv.sign(params, root, pubSeed, &otsA)
-		copy(signature[params.indexBytes+n:params.indexBytes+n+params.wotsSignLen], wotsSign)
-
-		// Compute the authentication path for the used WOTS leaf
-		treehash(params, root, signature[params.indexBytes+n+params.wotsSignLen:params.indexBytes+n+params.wotsSignLen+params.treeHeight*n], prvSeed, pubSeed, idxLeaf, otsA)
+		// Compute the authentication path for the used WOTS leaf and the root
+		// of this subtree, which is signed on the next layer
+		if err := treehash(hs, root, sm[:params.treeHeight*n], idxLeaf, otsA); err != nil {
+			return err
+		}
+		sm = sm[params.treeHeight*n:]
 	}
+	return nil
+}
 
-	return &signature
+// signOTS writes the WOTS signature over m with the one-time key at otsA to sm
+func signOTS(hs *hasher, sm, m []byte, otsA *address) {
+	wotsPrv := *generatePrivate(hs, otsA)
+	wotsSign := *wotsPrv.sign(hs, m, otsA)
+	copy(sm, wotsSign)
 }
@@ -55,6 +55,7 @@ func TestVerify(t *testing.T) {
 		t.Fatal(err)
 	}
 	for name, params := range testParams {
+		name, params := name, params
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 			var pub PublicXMSS
@@ -78,4 +79,157 @@ func TestVerify(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestXMSSMT(t *testing.T) {
+	t.Parallel()
+	if SHA2_20_4_256.indexBytes != 3 {
+		t.Errorf("XMSS^MT test failed. Expected 3 index bytes, got %d", SHA2_20_4_256.indexBytes)
+	}
+	testSignVerify(t, SHA2_20_4_256)
+
+	// Indices past 2^31 must survive 32-bit platforms
+	params, err := NewParams(SHA2, 32, 16, 40, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSignVerify(t, params)
+}
+
+func TestSHA512(t *testing.T) {
+	t.Parallel()
+	testParams := map[string]*Params{
+		"SHA2_10_512":   SHA2_10_512,
+		"SHA2_20_4_512": SHA2_20_4_512,
+	}
+	for name, params := range testParams {
+		params := params
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			testSignVerify(t, params)
+		})
+	}
+}
+
+func TestSHAKE(t *testing.T) {
+	t.Parallel()
+	testParams := map[string]*Params{
+		"SHAKE_20_4_256": SHAKE_20_4_256,
+		"SHAKE_20_4_512": SHAKE_20_4_512,
+	}
+	for name, params := range testParams {
+		params := params
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			testSignVerify(t, params)
+		})
+	}
+}
+
+func Test192(t *testing.T) {
+	t.Parallel()
+	// Signature size from NIST SP 800-208, Table 9
+	if SHA2_10_192.SignBytes() != 1492 {
+		t.Errorf("Expected SHA2_10_192 signatures of 1492 bytes, got %d", SHA2_10_192.SignBytes())
+	}
+	testParams := map[string]*Params{
+		"SHA2_20_4_192":     SHA2_20_4_192,
+		"SHAKE256_20_4_192": SHAKE256_20_4_192,
+	}
+	for name, params := range testParams {
+		params := params
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			testSignVerify(t, params)
+		})
+	}
+}
+
+// testSignVerify generates a key pair and signs at the first leaf. For
+// XMSS^MT it also signs at a leaf that uses a non-zero tree address on every
+// layer, and at index 2^31 if the tree is high enough.
+func testSignVerify(t *testing.T, params *Params) {
+	prv, pub := GenerateXMSSKeypair(params)
+	msg := make([]byte, 32)
+	rand.Read(msg)
+	m := make([]byte, params.SignBytes()+len(msg))
+
+	indices := []uint64{0}
+	if params.d > 1 {
+		indices = append(indices, params.MaxSignatures()-2)
+	}
+	if params.fullHeight > 31 {
+		indices = append(indices, 1<<31)
+	}
+	for _, idx := range indices {
+		copy((*prv)[:params.indexBytes], indexToByte(idx, int(params.indexBytes)))
+		sig := *prv.Sign(params, msg)
+		if len(sig) != params.SignBytes()+len(msg) {
+			t.Fatalf("Signature length %d, expected %d", len(sig), params.SignBytes()+len(msg))
+		}
+		if !Verify(params, m, sig, *pub) {
+			t.Errorf("Verification does not match at index %d", idx)
+		}
+		sig[params.SignBytes()-1] ^= 1
+		if Verify(params, m, sig, *pub) {
+			t.Errorf("Flipped bit did not invalidate at index %d", idx)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+	params := SHA2_20_4_256
+	prv, pub := GenerateXMSSKeypair(params)
+	msg := make([]byte, 32)
+	rand.Read(msg)
+	sig, err := prv.SignMessage(params, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make([]byte, len(sig))
+	if err := VerifyMessage(params, m, sig, *pub); err != nil {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	if !bytes.Equal(m[params.SignBytes():], msg) {
+		t.Error("Verification did not recover the message")
+	}
+
+	cases := []struct {
+		name string
+		m    []byte
+		sig  []byte
+		pub  []byte
+		err  error
+	}{
+		{"short_public_key", m, sig, (*pub)[1:], ErrInvalidPublicKey},
+		{"short_signature", m[:10], sig[:10], *pub, ErrInvalidSignatureLength},
+		{"empty_signature", nil, nil, *pub, ErrInvalidSignatureLength},
+		{"short_message_buffer", m[:len(m)-1], sig, *pub, ErrInvalidMessageBuffer},
+		{"long_message_buffer", append(m, 0), sig, *pub, ErrInvalidMessageBuffer},
+		{"mismatched_message_buffer", m, append(append([]byte{}, sig[:params.SignBytes()]...), 1), *pub, ErrInvalidMessageBuffer},
+	}
+	for _, c := range cases {
+		if err := VerifyMessage(params, c.m, c.sig, c.pub); err != c.err {
+			t.Errorf("%s: expected %v, got %v", c.name, c.err, err)
+		}
+		if Verify(params, c.m, c.sig, c.pub) {
+			t.Errorf("%s: Verify accepted malformed input", c.name)
+		}
+	}
+
+	sig[0] ^= 1
+	if err := VerifyMessage(params, m, sig, *pub); err != ErrInvalidSignature {
+		t.Errorf("Expected %v for a modified signature, got %v", ErrInvalidSignature, err)
+	}
+
+	if _, err := (*prv)[1:].SignMessage(params, msg); err != ErrInvalidPrivateKey {
+		t.Errorf("Expected %v for a short private key, got %v", ErrInvalidPrivateKey, err)
+	}
+	if (*prv)[1:].Sign(params, msg) != nil {
+		t.Error("Sign did not refuse a short private key")
+	}
+	if _, err := GenerateKey(params, bytes.NewReader(nil)); err != ErrEntropy {
+		t.Errorf("Expected %v for a failing entropy source, got %v", ErrEntropy, err)
+	}
+}